@@ -2,20 +2,15 @@ package cmd
 
 import (
 	"bufio"
+	"evo-cli/internal/ptyrun"
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
 	"strings"
-	"syscall"
 
-	"github.com/creack/pty"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 var cmCmd = &cobra.Command{
@@ -40,7 +35,7 @@ to skip the pre-commit and pre-push hooks.`,
 		result, err := exec.Command("git", "symbolic-ref", "--short", "HEAD").Output()
 		if err != nil {
 			fmt.Println("Error getting current Git branch")
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 		currentBranch := strings.TrimSpace(string(result))
 
@@ -57,7 +52,8 @@ to skip the pre-commit and pre-push hooks.`,
 				break
 			}
 		}
-		if isConventional == "n" {
+		// A dry run only shows the commit, it asks nothing.
+		if isConventional == "n" && !dryRun() {
 			fmt.Print("Is this a conventional commit? (y/n): ")
 			scanner := bufio.NewScanner(os.Stdin)
 			scanner.Scan()
@@ -84,51 +80,27 @@ to skip the pre-commit and pre-push hooks.`,
 			fmt.Println(red("Commit will not be verified."))
 		}
 
-		fmt.Printf("Commit message is:\n> " + yellow(commitMessage) + "\nConfirm? (y/n): ")
-		scanner := bufio.NewScanner(os.Stdin)
-		scanner.Scan()
-		confirm := scanner.Text()
-		if strings.ToLower(confirm) != "y" {
-			fmt.Println("Commit cancelled.")
-			os.Exit(0)
-		}
-
 		commitArgs := []string{"git", "commit", "-m", commitMessage}
 		if noVerify {
 			commitArgs = append(commitArgs, "--no-verify")
 		}
-		cmCommand := exec.Command(commitArgs[0], commitArgs[1:]...)
 
-		// throw command in a pty cause docker is ass
-		ptmx, err := pty.Start(cmCommand)
-		if err != nil {
-			fmt.Println("Error:", err)
+		if dryRun() {
+			fmt.Println("Commit message is:\n> " + yellow(commitMessage))
+			fmt.Println("Would run:\n> " + highlightShell(shellQuote(commitArgs)))
 			return
 		}
 
-		// Handle pty size.
-		ch := make(chan os.Signal, 1)
-		signal.Notify(ch, syscall.SIGWINCH)
-		go func() {
-			for range ch {
-				if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
-					log.Printf("error resizing pty: %s", err)
-				}
-			}
-		}()
-		ch <- syscall.SIGWINCH                        // Initial resize.
-		defer func() { signal.Stop(ch); close(ch) }() // Cleanup signals when done.
-
-		// set stdin in raw mode. (for ctrl+d and shit)
-		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-		if err != nil {
-			panic(err)
+		fmt.Printf("Commit message is:\n> " + yellow(commitMessage) + "\nConfirm? (y/n): ")
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		confirm := scanner.Text()
+		if strings.ToLower(confirm) != "y" {
+			fmt.Println("Commit cancelled.")
+			os.Exit(0)
 		}
-		defer func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }() // Best effort.
 
-		// Copy stdin to the pty and the pty to stdout.
-		go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
-		_, _ = io.Copy(os.Stdout, ptmx)
+		exitOnFailure(spawn("cm", &ptyrun.Runner{}, commitArgs[0], commitArgs[1:]...))
 	},
 }
 
@@ -147,6 +119,18 @@ func findGitRoot(currentDirectory string) (string, error) {
 	return "", fmt.Errorf("no Git repository found")
 }
 
+// shellQuote joins args into a command line that can be pasted in a shell.
+func shellQuote(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`&|;<>()*?!#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
 func contains(haystack []string, needle string) bool {
 	for _, a := range haystack {
 		if a == needle {
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Report problems with the configuration and Makefile targets",
+	Long: `Report problems with the configuration and Makefile targets.
+
+Lists the Makefiles evo read, targets that could not be parsed, targets
+that had to be renamed because their name is already used by another command
+and @param annotations that got no flag because evo uses its name.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		problems := 0
+
+		fmt.Println(yellow("Config file:"), blue(viper.ConfigFileUsed()))
+		if currentProject.Name != "" {
+			fmt.Println(yellow("Current project:"), blue(currentProject.Name))
+		}
+
+		for _, report := range makefileReports {
+			fmt.Println()
+			fmt.Println(yellow("Makefile targets of"), blue(report.Command))
+			switch {
+			case report.Err != nil:
+				fmt.Println("  " + red("✗ ") + report.Err.Error())
+				problems++
+				continue
+			case report.Makefile == nil:
+				fmt.Println("  " + yellow("- no Makefile configured or found"))
+				continue
+			}
+
+			fmt.Println("  "+green("✓"), report.Makefile.Path, fmt.Sprintf("(%d targets, %d files)", len(report.Makefile.Targets), len(report.Makefile.Files)))
+			for _, problem := range report.Makefile.Problems {
+				fmt.Println("  " + red("✗ ") + problem.String())
+				problems++
+			}
+		}
+
+		if len(commandCollisions) > 0 {
+			fmt.Println()
+			fmt.Println(yellow("Name collisions"))
+			for _, collision := range commandCollisions {
+				fmt.Printf("  %s %s %s is shadowed, run it as %s\n", red("✗"), collision.Command, collision.Name, blue(collision.Command+" "+collision.ExposedAs))
+				problems++
+			}
+		}
+
+		if len(paramCollisions) > 0 {
+			fmt.Println()
+			fmt.Println(yellow("Parameters without a flag"))
+			for _, collision := range paramCollisions {
+				fmt.Printf("  %s %s %s: --%s is a flag of evo, pass %s\n", red("✗"), collision.Command, collision.Target, collision.Flag, blue(collision.Param+"=…"))
+				problems++
+			}
+		}
+
+		fmt.Println()
+		if problems == 0 {
+			fmt.Println(green("No problems found"))
+		} else {
+			fmt.Println(red(fmt.Sprintf("%d problem(s) found", problems)))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"evo-cli/internal"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var (
+	bold    = color.New(color.Bold).SprintFunc()
+	magenta = color.New(color.FgHiMagenta).SprintfFunc()
+	faint   = color.New(color.Faint).SprintFunc()
+)
+
+// dryRun reports whether --dry-run was passed.
+func dryRun() bool {
+	enabled, _ := rootCmd.PersistentFlags().GetBool("dry-run")
+	return enabled
+}
+
+// printDryRun shows the commands make would run for a target, grouped by the
+// targets that would be updated, and returns the exit code of make.
+func printDryRun(makefileDirectory, target string, args []string) int {
+	fmt.Println(yellow("Dry run of"), green("make "+strings.Join(append([]string{target}, args...), " ")), faint("(nothing is executed)"))
+
+	steps, err := internal.DryRun(makefileDirectory, append([]string{target}, args...))
+	for _, step := range steps {
+		fmt.Println()
+		if step.Target != "" {
+			fmt.Printf("%s %s %s\n", blue("▸"), bold(step.Target), faint(fmt.Sprintf("(%s:%d, %s)", step.File, step.Line, step.Reason)))
+		}
+		for _, command := range step.Commands {
+			fmt.Println("    " + highlightShell(command))
+		}
+	}
+	if len(steps) == 0 && err == nil {
+		fmt.Println()
+		fmt.Println(green("Nothing to be done, every target is up to date"))
+	}
+	if err != nil {
+		fmt.Println()
+		fmt.Println(red("Error:"), err)
+	}
+	return exitCode(err)
+}
+
+// highlightShell colours a shell command: the program is bold, flags are
+// yellow, quoted strings green, variables magenta and operators red.
+func highlightShell(command string) string {
+	var b strings.Builder
+	expectProgram := true
+	for _, token := range shellTokens(command) {
+		switch {
+		case strings.TrimSpace(token) == "":
+			b.WriteString(token)
+		case token == "&&" || token == "||" || token == "|" || token == ";" || token == ">" || token == ">>" || token == "<":
+			b.WriteString(red(token))
+			expectProgram = token != ">" && token != ">>" && token != "<"
+		case strings.HasPrefix(token, "'") || strings.HasPrefix(token, "\""):
+			b.WriteString(green(token))
+			expectProgram = false
+		case strings.HasPrefix(token, "$"):
+			b.WriteString(magenta(token))
+			expectProgram = false
+		case expectProgram:
+			b.WriteString(bold(blue(token)))
+			expectProgram = false
+		case strings.HasPrefix(token, "-"):
+			b.WriteString(yellow(token))
+		default:
+			b.WriteString(token)
+		}
+	}
+	return b.String()
+}
+
+// shellTokens splits a command into words, whitespace and operators while
+// keeping quoted strings together. Joining the tokens gives the command back.
+func shellTokens(command string) []string {
+	var (
+		tokens []string
+		word   strings.Builder
+		quote  rune
+	)
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			word.WriteRune(r)
+			if r == quote {
+				quote = 0
+				flush()
+			}
+		case r == '\'' || r == '"':
+			flush()
+			quote = r
+			word.WriteRune(r)
+		case r == ' ' || r == '\t':
+			flush()
+			tokens = append(tokens, string(r))
+		case strings.ContainsRune("&|;<>", r):
+			flush()
+			operator := string(r)
+			if i+1 < len(runes) && (runes[i+1] == r) && r != ';' && r != '<' {
+				operator += string(r)
+				i++
+			}
+			tokens = append(tokens, operator)
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
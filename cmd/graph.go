@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"evo-cli/internal"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph <target>",
+	Short: "Show the prerequisite graph of a Makefile target",
+	Long: `Show the prerequisite graph of a Makefile target.
+
+The graph is printed as a tree by default, use --format dot or --format
+mermaid to generate a graph for documentation. With --from-make the graph is
+read from the database printed by "make -pn", which also knows about rules
+generated at runtime.`,
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		makefile, err := discoverTargets(currentProject.MakefilePath)
+		if err != nil || makefile == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var names []string
+		for _, target := range makefile.Targets {
+			names = append(names, target.Name+"\t"+target.Description)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		fromMake, _ := cmd.Flags().GetBool("from-make")
+		target := args[0]
+
+		var graph internal.MakefileGraph
+		if fromMake {
+			var err error
+			graph, err = internal.LoadMakeDatabase(currentProject.MakefilePath, target)
+			if err != nil {
+				fmt.Println(red("Error:"), err)
+				os.Exit(1)
+			}
+		} else {
+			// The graph needs every parsed target, not only the ones
+			// makefile_list_target lists.
+			makefile, err := internal.LoadMakefile(currentProject.MakefilePath, "")
+			if errors.Is(err, internal.ErrNoMakefile) {
+				fmt.Println(red("No Makefile found"))
+				os.Exit(1)
+			}
+			if err != nil {
+				fmt.Println(red("Error reading Makefile targets:"), err)
+				os.Exit(1)
+			}
+			graph = internal.NewMakefileGraph(makefile.Targets)
+		}
+
+		if _, ok := graph[target]; !ok {
+			if fromMake {
+				fmt.Println(red("Unknown target:"), blue(target))
+			} else {
+				fmt.Println(red("Unknown target:"), blue(target), "(targets generated at runtime are only known with --from-make)")
+			}
+			os.Exit(1)
+		}
+
+		switch format {
+		case "tree":
+			fmt.Print(graph.Tree(target))
+		case "dot":
+			fmt.Print(graph.Dot(target))
+		case "mermaid":
+			fmt.Print(graph.Mermaid(target))
+		default:
+			fmt.Println(red("Unknown format:"), blue(format), "(expected tree, dot or mermaid)")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+	graphCmd.Flags().StringP("format", "f", "tree", "Output format: tree, dot or mermaid")
+	graphCmd.Flags().Bool("from-make", false, "Read the graph from the make database (make -pn) instead of parsing the Makefile")
+	_ = graphCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"tree", "dot", "mermaid"}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"errors"
+	"evo-cli/internal/history"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the Makefile targets, tests and commits run before",
+	Long: `Show the Makefile targets, tests and commits run before, with when and
+where they ran and whether they passed.
+
+Filter the list with --target, --status and --since/--until, which take a
+date like 2024-05-01, a date and time like "2024-05-01 14:00" or a duration
+like 24h. Run an entry again with "evo history rerun <id>".`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _ := cmd.Flags().GetString("target")
+		status, _ := cmd.Flags().GetString("status")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		var since, until time.Time
+		for name, value := range map[string]*time.Time{"since": &since, "until": &until} {
+			flag, _ := cmd.Flags().GetString(name)
+			if flag == "" {
+				continue
+			}
+			parsed, err := parseHistoryTime(flag)
+			if err != nil {
+				fmt.Println(red("Error:"), fmt.Sprintf("invalid --%s: %s", name, err))
+				os.Exit(1)
+			}
+			*value = parsed
+		}
+		if status != "" && status != "ok" && status != "failed" {
+			fmt.Println(red("Error:"), "--status must be ok or failed")
+			os.Exit(1)
+		}
+
+		entries, err := history.Load()
+		if err != nil {
+			fmt.Println(red("Error reading history:"), err)
+			os.Exit(1)
+		}
+
+		var matched []history.Entry
+		for _, entry := range entries {
+			switch {
+			case target != "" && !matchesHistoryTarget(entry, target):
+			case status == "ok" && entry.Failed(), status == "failed" && !entry.Failed():
+			case !since.IsZero() && entry.Start.Before(since):
+			case !until.IsZero() && entry.Start.After(until):
+			default:
+				matched = append(matched, entry)
+			}
+		}
+		if limit > 0 && len(matched) > limit {
+			matched = matched[len(matched)-limit:]
+		}
+		if len(matched) == 0 {
+			fmt.Println(yellow("No commands in the history"))
+			return
+		}
+		printHistory(matched)
+	},
+}
+
+var historyRerunCmd = &cobra.Command{
+	Use:   "rerun <id>",
+	Short: "Run a command from the history again",
+	Long: `Run a command from the history again, with the same arguments and in the
+same directory it ran in before.`,
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		entries, _ := history.Load()
+		var ids []string
+		for i := len(entries) - 1; i >= 0 && len(ids) < 50; i-- {
+			ids = append(ids, fmt.Sprintf("%d\t%s (%s)", entries[i].ID, entries[i].Target, entries[i].Start.Format("2006-01-02 15:04")))
+		}
+		return ids, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Println(red("Error:"), "invalid history id", args[0])
+			os.Exit(1)
+		}
+		entry, err := history.Find(id)
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+		if err := os.Chdir(entry.Dir); err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+
+		fmt.Println(yellow("Running again:"), green(shellQuote(append([]string{"evo"}, entry.Args...))), faint("in "+entry.Dir))
+		// Replace evo with the command, so it owns the terminal just like it
+		// did the first time.
+		err = syscall.Exec(executable, append([]string{"evo"}, entry.Args...), os.Environ())
+		fmt.Println(red("Error:"), err)
+		os.Exit(1)
+	},
+}
+
+// addHistory records a finished child process in the history and returns the
+// ID of its entry, or zero when it could not be written.
+func addHistory(target string, command []string, start time.Time, code int) int {
+	dir, _ := os.Getwd()
+	entry := &history.Entry{
+		Target:   target,
+		Command:  command,
+		Args:     os.Args[1:],
+		Dir:      dir,
+		Project:  currentProject.Name,
+		Start:    start,
+		Duration: time.Since(start),
+		ExitCode: code,
+	}
+	if err := history.Add(entry); err != nil {
+		return 0
+	}
+	return entry.ID
+}
+
+// matchesHistoryTarget reports whether entry ran target, where "test" also
+// matches the test runs recorded as "test <filter>".
+func matchesHistoryTarget(entry history.Entry, target string) bool {
+	return entry.Target == target || strings.HasPrefix(entry.Target, target+" ")
+}
+
+// parseHistoryTime parses a date, a date and time or a duration before now.
+func parseHistoryTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05"} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	return time.Time{}, errors.New("expected a date like 2024-05-01, a time like \"2024-05-01 14:00\" or a duration like 24h")
+}
+
+func printHistory(entries []history.Entry) {
+	idWidth, targetWidth := len("ID"), len("Target")
+	for _, entry := range entries {
+		idWidth = max(idWidth, len(strconv.Itoa(entry.ID)))
+		targetWidth = max(targetWidth, len(entry.Target))
+	}
+
+	fmt.Println(bold(fmt.Sprintf("%*s  %-16s  %-8s  %4s  %-9s  %-*s  %s", idWidth, "ID", "Started", "Status", "Exit", "Duration", targetWidth, "Target", "Directory")))
+	for _, entry := range entries {
+		status := green(fmt.Sprintf("%-8s", "✓ ok"))
+		if entry.Failed() {
+			status = red(fmt.Sprintf("%-8s", "✗ failed"))
+		}
+		fmt.Printf("%*d  %-16s  %s  %4d  %-9s  %-*s  %s\n",
+			idWidth, entry.ID,
+			entry.Start.Local().Format("2006-01-02 15:04"),
+			status,
+			entry.ExitCode,
+			entry.Duration.Round(time.Millisecond),
+			targetWidth, entry.Target,
+			faint(entry.Dir),
+		)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyRerunCmd)
+
+	historyCmd.Flags().StringP("target", "t", "", "Only show runs of this target")
+	historyCmd.Flags().String("status", "", "Only show runs that are ok or failed")
+	historyCmd.Flags().String("since", "", "Only show runs started after this date or duration ago")
+	historyCmd.Flags().String("until", "", "Only show runs started before this date or duration ago")
+	historyCmd.Flags().IntP("limit", "n", 20, "Show at most this many of the latest runs, 0 shows all")
+	_ = historyCmd.RegisterFlagCompletionFunc("status", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"ok", "failed"}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"evo-cli/internal/ansi"
+	"evo-cli/internal/history"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [last|<id>]",
+	Short: "Show the saved output of a run from the history",
+	Long: `Show the saved output of a run from the history, the last run by default.
+
+The output of every Makefile target, test and commit run is saved without
+colours under the evo-cli data directory. Logs are opened in $PAGER, use
+--grep to only show the lines matching a regular expression. Set logs.keep in
+evo-cli.yml to change how many logs are kept, 0 turns saving them off:
+
+	logs:
+	  keep: 100`,
+	Args: cobra.MaximumNArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		entries, _ := history.Load()
+		ids := []string{"last\tThe most recent run"}
+		for i := len(entries) - 1; i >= 0 && len(ids) < 50; i-- {
+			if path, err := history.LogPath(entries[i].ID); err == nil && fileExists(path) {
+				ids = append(ids, fmt.Sprintf("%d\t%s (%s)", entries[i].ID, entries[i].Target, entries[i].Start.Format("2006-01-02 15:04")))
+			}
+		}
+		return ids, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		pattern, _ := cmd.Flags().GetString("grep")
+		printPath, _ := cmd.Flags().GetBool("path")
+
+		entry, err := findLogEntry(append(args, "last")[0])
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+		path, err := history.LogPath(entry.ID)
+		if err == nil && !fileExists(path) {
+			err = fmt.Errorf("the output of run %d was not saved or has been removed", entry.ID)
+		}
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+
+		switch {
+		case printPath:
+			fmt.Println(path)
+		case pattern != "":
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				fmt.Println(red("Error:"), "invalid --grep:", err)
+				os.Exit(1)
+			}
+			if !grepLog(path, re) {
+				os.Exit(1)
+			}
+		default:
+			showLog(entry, path)
+		}
+	},
+}
+
+// runLog saves the output of a child process without escape sequences.
+type runLog struct {
+	*ansi.Writer
+	log *history.Log
+}
+
+// startLog starts saving the output of a child process. It returns nil when
+// logs are turned off or cannot be written.
+func startLog() *runLog {
+	if logsToKeep() <= 0 {
+		return nil
+	}
+	log, err := history.CreateLog()
+	if err != nil {
+		return nil
+	}
+	return &runLog{Writer: ansi.NewWriter(log), log: log}
+}
+
+// save names the log after the history entry with id and removes the oldest
+// logs.
+func (l *runLog) save(id int) {
+	if l == nil {
+		return
+	}
+	if err := l.log.Save(id); err != nil {
+		return
+	}
+	_ = history.PruneLogs(logsToKeep())
+}
+
+// logsToKeep returns logs.keep from evo-cli.yml.
+func logsToKeep() int {
+	return viper.GetInt("logs.keep")
+}
+
+// findLogEntry returns the history entry for "last" or an id.
+func findLogEntry(arg string) (history.Entry, error) {
+	if arg != "last" {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return history.Entry{}, fmt.Errorf("invalid history id %s", arg)
+		}
+		return history.Find(id)
+	}
+
+	entries, err := history.Load()
+	if err != nil {
+		return history.Entry{}, err
+	}
+	if len(entries) == 0 {
+		return history.Entry{}, errors.New("no commands in the history")
+	}
+	return entries[len(entries)-1], nil
+}
+
+// showLog opens a log in $PAGER, or prints it when stdout is not a terminal.
+func showLog(entry history.Entry, path string) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(content)
+		return
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	fmt.Println(yellow("Output of"), green(entry.Target), faint(fmt.Sprintf("(run %d, %s, exit code %d)", entry.ID, entry.Start.Format("2006-01-02 15:04"), entry.ExitCode)))
+	pagerCmd := exec.Command("sh", "-c", pager+` "$1"`, "sh", path)
+	pagerCmd.Stdin, pagerCmd.Stdout, pagerCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := pagerCmd.Run(); err != nil {
+		fmt.Println(red("Error:"), err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// grepLog prints the lines of a log matching re with their line numbers, and
+// reports whether any line matched.
+func grepLog(path string, re *regexp.Regexp) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(red("Error:"), err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	matched := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if !re.MatchString(text) {
+			continue
+		}
+		matched = true
+		fmt.Printf("%s %s\n", faint(fmt.Sprintf("%6d", line)), re.ReplaceAllStringFunc(text, func(match string) string { return red(match) }))
+	}
+	return matched
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().StringP("grep", "g", "", "Only show lines matching this regular expression")
+	logsCmd.Flags().Bool("path", false, "Print the path of the log instead of showing it")
+
+	viper.SetDefault("logs.keep", 100)
+}
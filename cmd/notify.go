@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"evo-cli/internal/notify"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// notifyFinished sends a notification when the command named label ran for
+// longer than its threshold. Notifications are configured in evo-cli.yml,
+// nothing is sent without channels:
+//
+//	notifications:
+//	  channels: [bell, osc9, notify-send]
+//	  threshold: 30s
+//	  thresholds:
+//	    build: 10s
+//	    test: 1m
+func notifyFinished(label string, code int, duration time.Duration) {
+	channels := viper.GetStringSlice("notifications.channels")
+	if len(channels) == 0 || duration < notificationThreshold(label) {
+		return
+	}
+
+	// Escape sequences are only understood by a terminal.
+	var terminal io.Writer
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		terminal = os.Stderr
+	}
+
+	notification := notify.Notification{
+		Title: "evo " + label + " finished",
+		Body:  fmt.Sprintf("Succeeded after %s", duration.Round(time.Second)),
+	}
+	if code != 0 {
+		notification.Title = "evo " + label + " failed"
+		notification.Body = fmt.Sprintf("Exit code %d after %s", code, duration.Round(time.Second))
+		notification.Failed = true
+	}
+	if err := notify.Send(channels, terminal, notification); err != nil {
+		fmt.Fprintln(os.Stderr, red("Error sending notification:"), err)
+	}
+}
+
+// notificationThreshold returns how long label has to run before a
+// notification is sent. Test runs, labelled "test <filter>", use the
+// threshold of "test".
+func notificationThreshold(label string) time.Duration {
+	thresholds := viper.GetStringMap("notifications.thresholds")
+	for _, name := range []string{label, strings.Fields(label + " ")[0]} {
+		if _, ok := thresholds[strings.ToLower(name)]; ok {
+			return viper.GetDuration("notifications.thresholds." + name)
+		}
+	}
+	return viper.GetDuration("notifications.threshold")
+}
+
+func init() {
+	viper.SetDefault("notifications.threshold", 30*time.Second)
+}
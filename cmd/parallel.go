@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"evo-cli/internal/ptyrun"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// prefixColors are cycled through to tell the output of targets apart.
+var prefixColors = []*color.Color{
+	color.New(color.FgHiCyan),
+	color.New(color.FgHiMagenta),
+	color.New(color.FgHiBlue),
+	color.New(color.FgHiYellow),
+	color.New(color.FgHiGreen),
+	color.New(color.FgCyan),
+	color.New(color.FgMagenta),
+	color.New(color.FgBlue),
+}
+
+// targetResult is the outcome of one target of a multi-target run.
+type targetResult struct {
+	Target   string
+	ExitCode int
+	Err      error
+	Duration time.Duration
+}
+
+// splitTargets separates the target names in args from the arguments meant
+// for make, so "evo lint test build FILTER=x" runs three
+// targets with FILTER=x.
+func splitTargets(known map[string]bool, args []string) ([]string, []string) {
+	var targets, rest []string
+	for _, arg := range args {
+		if known[arg] {
+			targets = append(targets, arg)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return targets, rest
+}
+
+// addParallelFlag declares --parallel on a command that runs Makefile
+// targets.
+func addParallelFlag(cmd *cobra.Command) {
+	cmd.Flags().IntP("parallel", "j", 1, "Number of Makefile targets to run at once when several are given")
+}
+
+// parallelism returns the value of --parallel.
+func parallelism(cmd *cobra.Command) int {
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	return max(1, parallel)
+}
+
+// runMakeTargets runs every target in its own pty, at most parallel at a
+// time, and prefixes each line of output with the name of its target. A
+// summary of exit codes and durations is printed once all targets finished,
+// evo exits with the exit code of the first target that failed.
+func runMakeTargets(makefileDirectory string, targets, args []string, parallel int) {
+	if dryRun() {
+		code := 0
+		for _, target := range targets {
+			if targetCode := printDryRun(makefileDirectory, target, args); code == 0 {
+				code = targetCode
+			}
+			fmt.Println()
+		}
+		exitOnFailure(code)
+		return
+	}
+
+	width := 0
+	for _, target := range targets {
+		width = max(width, len(target))
+		rememberTarget(makefileDirectory, target)
+	}
+
+	start := time.Now()
+	var out io.Writer = os.Stdout
+	recording := startRecording(strings.Join(targets, "+"), append([]string{"make", "-C", makefileDirectory}, append(targets, args...)...))
+	if recording != nil {
+		out = io.MultiWriter(os.Stdout, recording)
+	}
+
+	fmt.Println(yellow("Running targets:"), green(strings.Join(targets, ", ")), yellow(fmt.Sprintf("(%d at a time)", parallel)))
+
+	var (
+		output  sync.Mutex
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, parallel)
+		results = make([]targetResult, len(targets))
+	)
+	for i, target := range targets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, target string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			prefix := prefixColors[i%len(prefixColors)].Sprintf("%-*s │ ", width, target)
+			results[i] = runPrefixedTarget(makefileDirectory, target, args, prefix, width+3, out, &output)
+		}(i, target)
+	}
+	wg.Wait()
+
+	if recording != nil {
+		recording.Stop()
+	}
+	printTargetSummary(results, width)
+
+	// Exit with the status of the first target that failed.
+	code := 0
+	for _, result := range results {
+		if result.Err != nil || result.ExitCode != 0 {
+			code = max(result.ExitCode, 1)
+			break
+		}
+	}
+	notifyFinished(strings.Join(targets, "+"), code, time.Since(start))
+	exitOnFailure(code)
+}
+
+// runPrefixedTarget runs a single target in a pty and copies its output line
+// by line to out, holding output while writing so lines never interleave.
+func runPrefixedTarget(makefileDirectory, target string, args []string, prefix string, prefixWidth int, out io.Writer, output *sync.Mutex) targetResult {
+	start := time.Now()
+	writer := &prefixWriter{prefix: prefix, out: out, output: output}
+	runner := &ptyrun.Runner{
+		Stdin:  strings.NewReader(""),
+		Stdout: writer,
+		NoTTY:  noTTY(),
+		Grace:  gracePeriod(),
+	}
+	log := startLog()
+	if log != nil {
+		runner.Tee = append(runner.Tee, log)
+	}
+	if cols, rows, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		runner.Size = &pty.Winsize{Cols: uint16(max(20, cols-prefixWidth)), Rows: uint16(rows)}
+	}
+
+	code, err := runner.Run(context.Background(), "make", append([]string{"-C", makefileDirectory, target}, args...)...)
+	writer.Flush()
+	log.save(addHistory(target, append([]string{"make", "-C", makefileDirectory, target}, args...), start, code))
+	return targetResult{Target: target, ExitCode: code, Err: err, Duration: time.Since(start)}
+}
+
+// prefixWriter writes complete lines to out, each starting with prefix.
+type prefixWriter struct {
+	prefix  string
+	out     io.Writer
+	output  *sync.Mutex
+	pending []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.pending[:i])
+		w.pending = w.pending[i+1:]
+	}
+}
+
+// Flush writes the last line when it did not end with a newline.
+func (w *prefixWriter) Flush() {
+	if len(w.pending) > 0 {
+		w.writeLine(w.pending)
+		w.pending = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.output.Lock()
+	defer w.output.Unlock()
+	fmt.Fprintln(w.out, w.prefix+strings.TrimRight(string(line), "\r"))
+}
+
+func printTargetSummary(results []targetResult, width int) {
+	width = max(width, len("Target"))
+	fmt.Println()
+	fmt.Println(bold(fmt.Sprintf("%-*s  %-8s  %4s  %s", width, "Target", "Status", "Exit", "Duration")))
+	for _, result := range results {
+		status := green(fmt.Sprintf("%-8s", "✓ ok"))
+		if result.Err != nil || result.ExitCode != 0 {
+			status = red(fmt.Sprintf("%-8s", "✗ failed"))
+		}
+		fmt.Printf("%-*s  %s  %4d  %s\n", width, result.Target, status, result.ExitCode, result.Duration.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"evo-cli/internal/ptyrun"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// spawn runs a child process with runner and returns its exit code. label
+// names the process, like the make target it runs. When the process fails a
+// banner with the command line, exit code and duration is printed, since the
+// failure is easily lost in the output of the command.
+func spawn(label string, runner *ptyrun.Runner, name string, args ...string) int {
+	runner.NoTTY = runner.NoTTY || noTTY()
+	runner.Grace = gracePeriod()
+	if recording := startRecording(label, append([]string{name}, args...)); recording != nil {
+		runner.Tee = append(runner.Tee, recording)
+		defer recording.Stop()
+	}
+	log := startLog()
+	if log != nil {
+		runner.Tee = append(runner.Tee, log)
+	}
+	start := time.Now()
+	code, err := runner.Run(context.Background(), name, args...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("Error:"), err)
+	}
+	log.save(addHistory(label, append([]string{name}, args...), start, code))
+	if code != 0 {
+		printFailureBanner(append([]string{name}, args...), code, time.Since(start))
+	}
+	notifyFinished(label, code, time.Since(start))
+	return code
+}
+
+// gracePeriod returns grace_period from evo-cli.yml, how long a command gets
+// to exit after evo passed on Ctrl+C or SIGTERM before it is killed.
+func gracePeriod() time.Duration {
+	return viper.GetDuration("grace_period")
+}
+
+// noTTY reports whether --no-tty was passed.
+func noTTY() bool {
+	disabled, _ := rootCmd.PersistentFlags().GetBool("no-tty")
+	return disabled
+}
+
+func printFailureBanner(command []string, code int, duration time.Duration) {
+	fmt.Fprintf(os.Stderr, "\n%s %s %s\n",
+		red("✗ Failed:"),
+		bold(shellQuote(command)),
+		faint(fmt.Sprintf("(exit code %d after %s)", code, duration.Round(time.Millisecond))),
+	)
+}
+
+// exitCode returns the exit code of a command that returned err.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		return exitErr.ExitCode()
+	default:
+		return 1
+	}
+}
+
+// exitOnFailure exits evo with the exit code of a failed child process.
+func exitOnFailure(code int) {
+	switch {
+	case code < 0:
+		os.Exit(1)
+	case code > 0:
+		os.Exit(code)
+	}
+}
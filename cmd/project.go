@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Project is a directory with a Makefile that evo exposes targets for.
+// Projects are configured in the projects section of evo-cli.yml:
+//
+//	projects:
+//	  api:
+//	    makefile_path: ~/code/api
+//	  frontend: ~/code/frontend
+//
+// Without a projects section the top-level makefile_path is used as a single
+// unnamed project.
+type Project struct {
+	Name         string
+	MakefilePath string
+}
+
+// currentProject is the project selected for this invocation, its targets are
+// available as top-level commands.
+var currentProject Project
+
+// configuredProjects returns the projects from evo-cli.yml sorted by name.
+func configuredProjects() []Project {
+	var projects []Project
+	for name, value := range viper.GetStringMap("projects") {
+		path, ok := value.(string)
+		if !ok {
+			path = viper.GetString("projects." + name + ".makefile_path")
+		}
+		projects = append(projects, Project{Name: name, MakefilePath: expandHome(path)})
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	return projects
+}
+
+// selectProject picks the project named by --project, falling back to the
+// project whose directory contains the working directory and finally to the
+// top-level makefile_path.
+func selectProject(args []string) (Project, error) {
+	projects := configuredProjects()
+
+	if name := projectFlag(args); name != "" {
+		for _, project := range projects {
+			if project.Name == name {
+				return project, nil
+			}
+		}
+		return Project{}, fmt.Errorf("unknown project %q", name)
+	}
+
+	if cwd, err := os.Getwd(); err == nil {
+		var best Project
+		for _, project := range projects {
+			if containsPath(project.MakefilePath, cwd) && len(project.MakefilePath) > len(best.MakefilePath) {
+				best = project
+			}
+		}
+		if best.Name != "" {
+			return best, nil
+		}
+	}
+
+	return Project{MakefilePath: expandHome(viper.GetString("makefile_path"))}, nil
+}
+
+// projectFlag extracts the value of --project from args. The project has to
+// be known before cobra parses flags, since it decides which commands exist.
+func projectFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--project="); ok {
+			return value
+		}
+		if arg == "--project" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func containsPath(dir, path string) bool {
+	if dir == "" {
+		return false
+	}
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absolute, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~"); ok && (rest == "" || rest[0] == '/') {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + rest
+		}
+	}
+	return path
+}
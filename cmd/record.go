@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"evo-cli/internal/asciicast"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// autoRecording is the value of --record when it is passed without a file.
+const autoRecording = "auto"
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.\-]+`)
+
+// recordings holds the absolute paths of the files this process records to.
+var recordings sync.Map
+
+// recordingPath returns the file the output of label is recorded to, or an
+// empty string when --record was not passed. Without a file name recordings
+// are written to the current directory, named after label and the time.
+func recordingPath(label string) string {
+	path, _ := rootCmd.PersistentFlags().GetString("record")
+	if path != autoRecording {
+		return path
+	}
+	name := unsafeFileChars.ReplaceAllString(label, "-")
+	return fmt.Sprintf("evo-%s-%s.cast", name, time.Now().Format("20060102-150405"))
+}
+
+// recording is an asciicast recording in progress.
+type recording struct {
+	*asciicast.Writer
+	path string
+}
+
+// startRecording starts an asciicast recording of command when --record was
+// passed. It returns nil when nothing is recorded, failing to create the file
+// is reported but does not stop the command from running.
+func startRecording(label string, command []string) *recording {
+	path := recordingPath(label)
+	if path == "" {
+		return nil
+	}
+
+	if absolute, err := filepath.Abs(path); err == nil {
+		recordings.Store(absolute, true)
+	}
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	writer, err := asciicast.Create(path, asciicast.Header{
+		Width:   width,
+		Height:  height,
+		Command: shellQuote(command),
+		Title:   "evo " + label,
+		Env:     map[string]string{"SHELL": os.Getenv("SHELL"), "TERM": os.Getenv("TERM")},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("Error:"), "could not start recording:", err)
+		return nil
+	}
+	return &recording{Writer: writer, path: path}
+}
+
+// Stop finishes the recording and tells where it was written to.
+func (r *recording) Stop() {
+	if err := r.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, red("Error:"), "could not write recording:", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, faint("Recorded to "+r.path+", play it back with: evo replay "+r.path))
+}
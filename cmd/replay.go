@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"evo-cli/internal/asciicast"
+	"evo-cli/internal/ptyrun"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Play back a recording made with --record",
+	Long: `Play back an asciicast recording made with --record.
+
+Recordings are played at the speed they were recorded, use --speed to play
+them faster or slower and --max-idle to skip long pauses. The files can also
+be played with asciinema or uploaded to a ticket.`,
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"cast"}, cobra.ShellCompDirectiveFilterFileExt
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		speed, _ := cmd.Flags().GetFloat64("speed")
+		maxIdle, _ := cmd.Flags().GetDuration("max-idle")
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		ctx, stop := ptyrun.NotifyContext(context.Background())
+		defer stop()
+
+		_, err = asciicast.Play(ctx, file, os.Stdout, speed, maxIdle)
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			// Reset colours and show the cursor in case playback stopped halfway.
+			fmt.Print("\x1b[0m\x1b[?25h")
+		}
+		if ctx.Err() != nil {
+			fmt.Println()
+			return
+		}
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().Float64P("speed", "s", 1, "Playback speed, 2 plays twice as fast")
+	replayCmd.Flags().Duration("max-idle", 0, "Shorten pauses longer than this, like 2s")
+}
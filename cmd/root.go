@@ -1,102 +1,346 @@
 package cmd
 
 import (
+	"errors"
+	"evo-cli/internal"
+	"evo-cli/internal/ptyrun"
 	"fmt"
-	"io"
-	"log"
 	"os"
-	"os/exec"
-	"os/signal"
+	"slices"
 	"strings"
-	"syscall"
 
-	"github.com/creack/pty"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/term"
 )
 
 var rootCmd = &cobra.Command{
 	Use: "evo",
 }
 
-type MakefileTarget struct {
-	Name        string
-	Description string
+func Execute() {
+	project, err := selectProject(os.Args[1:])
+	if err != nil {
+		fmt.Println(red("Error:"), err)
+		os.Exit(1)
+	}
+	currentProject = project
+
+	// Everything registered so far is built into evo.
+	for _, builtin := range rootCmd.Commands() {
+		builtin.GroupID = builtinGroup.ID
+	}
+	rootCmd.SetHelpCommandGroupID(builtinGroup.ID)
+	rootCmd.SetCompletionCommandGroupID(builtinGroup.ID)
+
+	if needsTargets(os.Args[1:]) {
+		addTargetCommands(rootCmd, currentProject.MakefilePath)
+
+		projects := configuredProjects()
+		if len(projects) > 0 {
+			rootCmd.AddGroup(projectsGroup)
+		}
+		for _, project := range projects {
+			projectCmd := &cobra.Command{
+				Use:     project.Name,
+				Short:   fmt.Sprintf("Run targets of the %s project (%s)", project.Name, project.MakefilePath),
+				GroupID: projectsGroup.ID,
+			}
+			addUniqueCommand(rootCmd, projectCmd, "project")
+			addTargetCommands(projectCmd, project.MakefilePath)
+		}
+	}
+	rootCmd.AddGroup(builtinGroup)
+
+	err = rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
-func Execute() {
-	makefileDirectory := viper.GetString("makefile_path")
-	cmd := exec.Command("make", "-C", makefileDirectory, "list-targets-full")
+// Help sections of the root command. Makefile targets are listed first, in
+// the "##@ Section" groups of the Makefile when it has any.
+var (
+	targetsGroup  = &cobra.Group{ID: "targets", Title: "Makefile Targets:"}
+	projectsGroup = &cobra.Group{ID: "projects", Title: "Projects:"}
+	builtinGroup  = &cobra.Group{ID: "builtin", Title: "Evo Commands:"}
+)
+
+// makefileReport records the outcome of reading a Makefile, for evo doctor.
+type makefileReport struct {
+	Command   string
+	Directory string
+	Makefile  *internal.Makefile
+	Err       error
+}
 
-	cmd.Dir = makefileDirectory
-	output, err := cmd.Output()
+// commandCollision is a command that was renamed because its name was
+// already taken by another command.
+type commandCollision struct {
+	Command   string
+	Name      string
+	ExposedAs string
+}
+
+// paramCollision is a @param annotation that got no flag because the flag
+// name is already used by evo, it is passed as NAME=value instead.
+type paramCollision struct {
+	Command string
+	Target  string
+	Param   string
+	Flag    string
+}
+
+var (
+	makefileReports   []makefileReport
+	commandCollisions []commandCollision
+	paramCollisions   []paramCollision
+)
+
+// addTargetCommands adds a command to parent for every target of the
+// Makefile in makefileDirectory. Hidden targets can be run but are left out
+// of the help output.
+func addTargetCommands(parent *cobra.Command, makefileDirectory string) {
+	makefile, err := discoverTargets(makefileDirectory)
+	makefileReports = append(makefileReports, makefileReport{
+		Command:   parent.CommandPath(),
+		Directory: makefileDirectory,
+		Makefile:  makefile,
+		Err:       err,
+	})
 	if err != nil {
-		fmt.Println(err)
+		fmt.Println(red("Error reading Makefile targets:"), err)
+		return
+	}
+	if makefile == nil {
+		return
+	}
+	known := targetNames(makefile.Targets)
+	for _, target := range makefile.Targets {
+		targetCmd := newTargetCommand(parent, makefileDirectory, target, known)
+		if target.Hidden {
+			targetCmd.Hidden = true
+		} else {
+			targetCmd.GroupID = targetGroup(parent, target.Group).ID
+		}
+		addUniqueCommand(parent, targetCmd, "make")
+	}
+}
+
+// addUniqueCommand adds cmd to parent. When parent already has a command with
+// the same name, cmd is exposed as prefix:name instead so that built-in
+// commands are never shadowed.
+func addUniqueCommand(parent, cmd *cobra.Command, prefix string) {
+	name := cmd.Name()
+	if hasCommand(parent, name) {
+		exposedAs := prefix + ":" + name
+		cmd.Use = strings.Replace(cmd.Use, name, exposedAs, 1)
+		commandCollisions = append(commandCollisions, commandCollision{
+			Command:   parent.CommandPath(),
+			Name:      name,
+			ExposedAs: exposedAs,
+		})
+		fmt.Fprintln(os.Stderr, yellow("Warning:"), fmt.Sprintf("%q is already a command, run it as %s", name, blue(parent.CommandPath()+" "+exposedAs)))
 	}
-	lines := strings.Split(string(output), "\n")
-	var targets []MakefileTarget
+	parent.AddCommand(cmd)
+}
 
-	for _, line := range lines {
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
+// hasCommand reports whether name resolves to a command of parent. Cobra only
+// adds the help and completion commands when executing, so they are checked
+// by name.
+func hasCommand(parent *cobra.Command, name string) bool {
+	if parent == rootCmd && (name == "help" || name == "completion") {
+		return true
+	}
+	for _, existing := range parent.Commands() {
+		if existing.Name() == name || existing.HasAlias(name) {
+			return true
 		}
-		name := parts[0]
-		description := strings.Join(parts[1:], " ")
+	}
+	return false
+}
 
-		targets = append(targets, MakefileTarget{Name: name, Description: description})
+// targetGroup returns the help section of parent for a Makefile section,
+// adding it the first time a target of that section shows up.
+func targetGroup(parent *cobra.Command, section string) *cobra.Group {
+	group := targetsGroup
+	if section != "" {
+		group = &cobra.Group{ID: "section:" + section, Title: section + ":"}
+	}
+	if !parent.ContainsGroup(group.ID) {
+		parent.AddGroup(group)
 	}
+	return group
+}
 
+// targetNames returns the set of target names.
+func targetNames(targets []internal.MakefileTarget) map[string]bool {
+	names := make(map[string]bool, len(targets))
 	for _, target := range targets {
-		target.Name = strings.TrimSpace(target.Name)
-		target.Description = strings.TrimSpace(target.Description)
-		makeTargetCmd := &cobra.Command{
-			Use:   target.Name,
-			Short: target.Description,
-			Run: func(cmd *cobra.Command, args []string) {
-				makeArgs := append([]string{"-C", makefileDirectory}, append([]string{target.Name}, args...)...)
-				makeCommand := exec.Command("make", makeArgs...)
-				makeCommand.Dir = "."
-
-				// throw command in a pty cause docker is ass
-				ptmx, err := pty.Start(makeCommand)
-				if err != nil {
-					fmt.Println("Error:", err)
-					return
-				}
-				// Handle pty size.
-				ch := make(chan os.Signal, 1)
-				signal.Notify(ch, syscall.SIGWINCH)
-				go func() {
-					for range ch {
-						if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
-							log.Printf("error resizing pty: %s", err)
-						}
-					}
-				}()
-				ch <- syscall.SIGWINCH                        // Initial resize.
-				defer func() { signal.Stop(ch); close(ch) }() // Cleanup signals when done.
-
-				// set stdin in raw mode. (for ctrl+d and shit)
-				oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-				if err != nil {
-					panic(err)
-				}
-				defer func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }() // Best effort.
-
-				// Copy stdin to the pty and the pty to stdout.
-				go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
-				_, _ = io.Copy(os.Stdout, ptmx)
-			},
+		names[target.Name] = true
+	}
+	return names
+}
+
+// newTargetCommand creates the command running target. Other targets of the
+// same Makefile can be passed as arguments to run several targets at once.
+func newTargetCommand(parent *cobra.Command, makefileDirectory string, target internal.MakefileTarget, known map[string]bool) *cobra.Command {
+	target.Name = strings.TrimSpace(target.Name)
+	target.Description = strings.TrimSpace(target.Description)
+	// params are the @param annotations that have a flag.
+	var params []internal.MakefileParam
+	makeTargetCmd := &cobra.Command{
+		Use:   target.Name,
+		Short: target.Description,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return validateParamFlags(cmd, params)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			targets, args := splitTargets(known, args)
+			args = append(paramArgs(cmd, params), args...)
+			if len(targets) > 0 {
+				runMakeTargets(makefileDirectory, append([]string{target.Name}, targets...), args, parallelism(cmd))
+				return
+			}
+			exitOnFailure(runMakeTarget(makefileDirectory, target.Name, args))
+		},
+	}
+	// Flags of evo come first, a @param with the same name goes without.
+	addParallelFlag(makeTargetCmd)
+	params = addParamFlags(makeTargetCmd, target.Params)
+	for _, param := range target.Params {
+		if !slices.ContainsFunc(params, func(p internal.MakefileParam) bool { return p.Name == param.Name }) {
+			paramCollisions = append(paramCollisions, paramCollision{
+				Command: parent.CommandPath(),
+				Target:  target.Name,
+				Param:   param.Name,
+				Flag:    paramFlagName(param),
+			})
 		}
-		rootCmd.AddCommand(makeTargetCmd)
 	}
-	err = rootCmd.Execute()
+	return makeTargetCmd
+}
+
+// runMakeTarget runs a make target in a pty, attached to the terminal, and
+// returns its exit code.
+func runMakeTarget(makefileDirectory, target string, args []string) int {
+	if dryRun() {
+		return printDryRun(makefileDirectory, target, args)
+	}
+	rememberTarget(makefileDirectory, target)
+
+	return spawn(target, &ptyrun.Runner{}, "make", append([]string{"-C", makefileDirectory, target}, args...)...)
+}
+
+// paramFlagName turns a make variable name into a flag name, DB_NAME becomes
+// --db-name.
+func paramFlagName(param internal.MakefileParam) string {
+	return strings.ReplaceAll(strings.ToLower(param.Name), "_", "-")
+}
+
+// addParamFlags declares a flag for every @param annotation of a target and
+// returns the annotations that got one. Names already used by a flag of evo
+// are skipped, those variables are passed as NAME=value instead.
+func addParamFlags(cmd *cobra.Command, params []internal.MakefileParam) []internal.MakefileParam {
+	var flagged []internal.MakefileParam
+	for _, param := range params {
+		name := paramFlagName(param)
+		if cmd.Flags().Lookup(name) != nil || rootCmd.PersistentFlags().Lookup(name) != nil {
+			continue
+		}
+		flagged = append(flagged, param)
+		usage := param.Description
+		if usage == "" {
+			usage = "Sets " + param.Name
+		}
+		if len(param.Values) > 0 {
+			usage += " (" + strings.Join(param.Values, "|") + ")"
+		}
+
+		switch param.Type {
+		case internal.ParamInt:
+			cmd.Flags().Int(name, 0, usage)
+		case internal.ParamBool:
+			cmd.Flags().Bool(name, false, usage)
+		default:
+			cmd.Flags().String(name, "", usage)
+		}
+
+		if len(param.Values) > 0 {
+			values := param.Values
+			_ = cmd.RegisterFlagCompletionFunc(name, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+				return values, cobra.ShellCompDirectiveNoFileComp
+			})
+		}
+	}
+	return flagged
+}
+
+// validateParamFlags rejects values that are not in the allowed list of
+// their @param annotation.
+func validateParamFlags(cmd *cobra.Command, params []internal.MakefileParam) error {
+	for _, param := range params {
+		flag := cmd.Flags().Lookup(paramFlagName(param))
+		if flag == nil || !flag.Changed || len(param.Values) == 0 {
+			continue
+		}
+		if !contains(param.Values, flag.Value.String()) {
+			return fmt.Errorf("invalid value %q for --%s, allowed values are %s", flag.Value.String(), flag.Name, strings.Join(param.Values, ", "))
+		}
+	}
+	return nil
+}
+
+// paramArgs translates the param flags that were set into VAR=value make
+// arguments. Booleans follow make conventions, true is 1 and false is empty.
+func paramArgs(cmd *cobra.Command, params []internal.MakefileParam) []string {
+	var args []string
+	for _, param := range params {
+		flag := cmd.Flags().Lookup(paramFlagName(param))
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		value := flag.Value.String()
+		if param.Type == internal.ParamBool {
+			value = map[string]string{"true": "1", "false": ""}[value]
+		}
+		args = append(args, param.Name+"="+value)
+	}
+	return args
+}
+
+// needsTargets reports whether the command line in args may refer to a
+// Makefile target. Built-in commands are resolved without looking at the
+// Makefile at all, so they start without parsing it or running make.
+func needsTargets(args []string) bool {
+	found, _, err := rootCmd.Find(args)
+	if err != nil || found == rootCmd {
+		// Unknown commands, help and shell completion are only resolved once
+		// cobra knows about every target.
+		return true
+	}
+	return found == genDocsCmd || found == doctorCmd
+}
+
+// discoverTargets returns the targets of the Makefile in makefileDirectory.
+// The Makefile is parsed natively unless makefile_list_target names a target
+// that prints the list itself (e.g. list-targets-full). Results are cached
+// until the Makefile or one of its includes changes.
+func discoverTargets(makefileDirectory string) (*internal.Makefile, error) {
+	makefile, err := internal.LoadMakefile(makefileDirectory, viper.GetString("makefile_list_target"))
 	if err != nil {
-		os.Exit(1)
+		// Running evo outside of a project is fine, there just are no targets.
+		if errors.Is(err, internal.ErrNoMakefile) && makefileDirectory == "" {
+			return nil, nil
+		}
+		return nil, err
 	}
+	return makefile, nil
 }
 
 func init() {
+	rootCmd.PersistentFlags().String("project", "", "Project from evo-cli.yml to run Makefile targets of")
+	rootCmd.PersistentFlags().Bool("dry-run", false, "Show what would be executed without running it")
+	rootCmd.PersistentFlags().Bool("no-tty", false, "Run commands with plain pipes instead of a pseudo terminal")
+	rootCmd.PersistentFlags().String("record", "", "Record the output to an asciicast file, named after the command unless given as --record=file.cast")
+	rootCmd.PersistentFlags().Lookup("record").NoOptDefVal = autoRecording
 }
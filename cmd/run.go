@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"evo-cli/internal"
+	"evo-cli/internal/cache"
+	"evo-cli/internal/picker"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// maxRecentTargets is how many recently run targets are remembered per
+// Makefile.
+const maxRecentTargets = 20
+
+var runCmd = &cobra.Command{
+	Use:   "run [target] [args...]",
+	Short: "Pick a Makefile target with a fuzzy finder and run it",
+	Long: `Pick a Makefile target with a fuzzy finder and run it.
+
+Without arguments an interactive finder lists the targets of the current
+project, recently used ones first, with a preview of their recipe. The
+target can also be passed directly, followed by more targets and arguments
+for make.`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		makefile, err := discoverTargets(currentProject.MakefilePath)
+		if err != nil {
+			fmt.Println(red("Error reading Makefile targets:"), err)
+			os.Exit(1)
+		}
+		if makefile == nil {
+			fmt.Println(red("No Makefile found"))
+			os.Exit(1)
+		}
+
+		if len(args) > 0 {
+			targets, makeArgs := splitTargets(targetNames(makefile.Targets), args[1:])
+			if len(targets) > 0 {
+				runMakeTargets(currentProject.MakefilePath, append([]string{args[0]}, targets...), makeArgs, parallelism(cmd))
+				return
+			}
+			exitOnFailure(runMakeTarget(currentProject.MakefilePath, args[0], makeArgs))
+			return
+		}
+
+		if noTTY() || !term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Println(red("The target picker needs a terminal, pass the target to run instead"))
+			os.Exit(1)
+		}
+
+		targets := rankRecentTargets(currentProject.MakefilePath, makefile.Targets)
+		items := make([]picker.Item, 0, len(targets))
+		for _, target := range targets {
+			items = append(items, picker.Item{
+				Title:       target.Name,
+				Description: target.Description,
+				Preview:     target.Recipe,
+			})
+		}
+
+		chosen, err := picker.Pick("make", items)
+		if errors.Is(err, picker.ErrCancelled) {
+			return
+		}
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+
+		fmt.Println(yellow("Running target:"), green(targets[chosen].Name))
+		exitOnFailure(runMakeTarget(currentProject.MakefilePath, targets[chosen].Name, nil))
+	},
+}
+
+// rankRecentTargets returns the visible targets with the recently run ones
+// first, most recent first, followed by the others in Makefile order.
+func rankRecentTargets(makefileDirectory string, targets []internal.MakefileTarget) []internal.MakefileTarget {
+	recent := recentTargets(makefileDirectory)
+	rank := map[string]int{}
+	for i, name := range recent {
+		rank[name] = i + 1
+	}
+
+	var ranked, rest []internal.MakefileTarget
+	for _, target := range targets {
+		if target.Hidden {
+			continue
+		}
+		if rank[target.Name] > 0 {
+			ranked = append(ranked, target)
+		} else {
+			rest = append(rest, target)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return rank[ranked[i].Name] < rank[ranked[j].Name] })
+	return append(ranked, rest...)
+}
+
+// recentTargetsVersion is bumped whenever the cached list changes shape.
+const recentTargetsVersion = 1
+
+// recentTargets returns the targets recently run from the Makefile in
+// makefileDirectory, most recent first.
+func recentTargets(makefileDirectory string) []string {
+	var names []string
+	cache.Read("recent", recentTargetsKey(makefileDirectory), recentTargetsVersion, &names)
+	return names
+}
+
+// rememberTarget moves target to the front of the recently run targets.
+func rememberTarget(makefileDirectory, target string) {
+	names := []string{target}
+	for _, name := range recentTargets(makefileDirectory) {
+		if name != target && len(names) < maxRecentTargets {
+			names = append(names, name)
+		}
+	}
+	cache.Write("recent", recentTargetsKey(makefileDirectory), recentTargetsVersion, names)
+}
+
+func recentTargetsKey(makefileDirectory string) string {
+	if absolute, err := filepath.Abs(strings.TrimSpace(makefileDirectory)); err == nil {
+		return absolute
+	}
+	return makefileDirectory
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	addParallelFlag(runCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"evo-cli/internal"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var targetsCmd = &cobra.Command{
+	Use:   "targets",
+	Short: "Manage the Makefile targets known to evo",
+	Long:  `Manage the Makefile targets evo exposes as commands.`,
+}
+
+var targetsRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Rebuild the cached list of Makefile targets",
+	Long: `Parse the Makefile again and rebuild the cached list of targets.
+
+The cache is invalidated automatically when the Makefile or one of its
+includes changes, this command is only needed when new files appear that
+an include pattern would pick up.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		makefile, err := internal.RefreshMakefile(currentProject.MakefilePath, viper.GetString("makefile_list_target"))
+		if err != nil {
+			fmt.Println(red("Error reading Makefile targets:"), err)
+			os.Exit(1)
+		}
+		fmt.Println(green("Cached"), blue(fmt.Sprint(len(makefile.Targets))), green("targets from"), yellow(makefile.Path))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(targetsCmd)
+	targetsCmd.AddCommand(targetsRefreshCmd)
+}
@@ -1,111 +1,112 @@
 package cmd
 
 import (
+	"errors"
+	"evo-cli/internal/picker"
+	"evo-cli/internal/ptyrun"
+	"evo-cli/internal/testframework"
 	"fmt"
 	"io"
-	"log"
 	"os"
-	"os/exec"
-	"os/signal"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"syscall"
 
-	"github.com/creack/pty"
 	"github.com/fatih/color"
-	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"golang.org/x/term"
 )
 
-func findMatchingFile(baseDir, word string) (string, error) {
-	// Define specific subdirectories to search within.
-	testDirs := []string{"testing", "tests"}
-	for _, dir := range testDirs {
-		// Construct the full directory path to search in.
-		fullPath := filepath.Join(baseDir, dir)
-
-		// If directory doesn't exist, skip it.
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-			continue
+// maxTestCandidates is how many loosely matching tests are listed when no
+// test is called exactly like the name given.
+const maxTestCandidates = 20
+
+// chooseTest returns the test to run when several match name. The user picks
+// one from a list, or gives its number with --pick when there is no terminal.
+// exact tells whether the tests are called name, or only loosely match it.
+// It returns false when the user cancelled.
+func chooseTest(dirPath, name string, matches []testframework.Test, exact bool, pick int) (testframework.Test, bool) {
+	if !exact && len(matches) > maxTestCandidates {
+		matches = matches[:maxTestCandidates]
+	}
+	if pick > 0 {
+		if pick > len(matches) {
+			fmt.Println(red("Error:"), fmt.Sprintf("--pick %d is out of range, %d tests match %s", pick, len(matches), name))
+			os.Exit(1)
+		}
+		return matches[pick-1], true
+	}
+	if len(matches) == 1 {
+		if !exact {
+			fmt.Println(yellow("No test is called"), blue(name)+yellow(", running the only close match"))
 		}
+		return matches[0], true
+	}
 
-		// Perform the search in the specified directory.
-		filePath, err := searchDirectory(fullPath, word)
-		if err != nil {
-			return "", err // If an error occurred, return it immediately.
+	if noTTY() || !term.IsTerminal(int(os.Stdin.Fd())) {
+		if exact {
+			fmt.Println(yellow("Multiple tests match"), blue(name)+yellow(", run one of them with --pick N or by its full name:"))
+		} else {
+			fmt.Println(yellow("No test is called"), blue(name)+yellow(", run one of the closest matches with --pick N or by its full name:"))
 		}
-		if filePath != "" {
-			return filePath, nil // Return the first found file path.
+		for i, match := range matches {
+			fmt.Printf("  %s %s %s\n", faint(fmt.Sprintf("%2d.", i+1)), green(match.String()), faint("("+testLocation(dirPath, match)+")"))
 		}
+		os.Exit(1)
 	}
-	return "", nil // Return empty if no file was found after searching all specified directories.
-}
 
-func searchDirectory(dir, word string) (string, error) {
-	// Define the regex pattern based on the word's prefix.
-	var pattern string
-	if strings.HasPrefix(word, "test") {
-		pattern = `public function ` + regexp.QuoteMeta(word)
-	} else {
-		pattern = `class ` + regexp.QuoteMeta(word)
+	items := make([]picker.Item, 0, len(matches))
+	for _, match := range matches {
+		items = append(items, picker.Item{
+			Title:       match.String(),
+			Description: testLocation(dirPath, match),
+			Preview:     sourceLines(match.File, match.Line, 10),
+		})
+	}
+	chosen, err := picker.Pick(name, items)
+	if errors.Is(err, picker.ErrCancelled) {
+		return testframework.Test{}, false
 	}
-
-	// Compile the regex to ensure it's valid.
-	re, err := regexp.Compile(pattern)
 	if err != nil {
-		return "", err // return with error if regex compilation fails
+		fmt.Println(red("Error:"), err)
+		os.Exit(1)
 	}
+	return matches[chosen], true
+}
 
-	// Slice to store paths of files that contain matches.
-	var matchedFiles []string
-
-	// Use filepath.Walk to iterate over all files in the provided directory tree.
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err // propagate errors encountered by Walk
-		}
-
-		// Check if the file is a symbolic link
-		if info.Mode()&os.ModeSymlink != 0 {
-			return nil // skip processing symbolic links
-		}
-
-		// If have no permission to read the file, skip it.
-		if info.Mode().Perm()&0o400 == 0 {
-			return nil
-		}
-
-		// Only process files.
-		if !info.IsDir() {
-			// Read the file content.
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return err // continue walking if file can't be read
-			}
-
-			// Check if content matches the pattern.
-			if re.Match(content) {
-				matchedFiles = append(matchedFiles, path)
-			}
-		}
+// testLocation returns where test is declared, relative to dirPath.
+func testLocation(dirPath string, test testframework.Test) string {
+	if test.Line == 0 {
+		return relativePath(dirPath, test.File)
+	}
+	return fmt.Sprintf("%s:%d", relativePath(dirPath, test.File), test.Line)
+}
 
-		return nil
-	})
+// sourceLines returns up to count lines of the file at path, starting at
+// line.
+func sourceLines(path string, line, count int) []string {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return "", err // return with error encountered during walking
+		return nil
 	}
+	lines := strings.Split(string(content), "\n")
+	start := min(max(line-1, 0), len(lines))
+	return lines[start:min(start+count, len(lines))]
+}
 
-	// Check the number of matched files and decide on the return value.
-	if len(matchedFiles) == 1 {
-		return matchedFiles[0], nil
-	} else if len(matchedFiles) > 1 {
-		return "", fmt.Errorf("multiple instances of 'public function %s' exist, please rename your test method", word)
+// findTests returns the suites and tests called name that adapter discovers
+// in baseDir. When none is called name the tests that loosely match it are
+// returned, best match first, and exact is false.
+func findTests(adapter testframework.Adapter, baseDir, name string) (matches []testframework.Test, exact bool, err error) {
+	tests, err := adapter.Discover(baseDir)
+	if err != nil {
+		return nil, false, err
 	}
-
-	return "", nil
+	if matches := testframework.Find(tests, name); len(matches) > 0 {
+		return matches, true, nil
+	}
+	return testframework.Search(tests, name), false, nil
 }
 
 var red = color.New(color.FgHiRed).SprintfFunc()
@@ -116,9 +117,45 @@ var blue = color.New(color.FgHiBlue).SprintfFunc()
 var testloopCmd = &cobra.Command{
 	Use:     "test-loop [test-class-or-function name]",
 	Aliases: []string{"tl"},
-	Short:   "Run a test class/function on demand, restart it with Ctrl+0",
-	Long:    `Run a test class/function on demand, restart it with Ctrl+0`,
-	Args:    cobra.ExactArgs(1),
+	Short:   "Run a test class/function and rerun it on changes or with a key press",
+	Long: `Run a test class/function, rerun it whenever a source or test file changes
+and control it with single key presses:
+
+	r, Enter  rerun the test
+	f         rerun only the tests that failed in the last run
+	w         toggle watching the sources or only the test file
+	c         clear the screen
+	q         quit
+
+While a test runs the keys are passed on to it, Ctrl+C stops the test.
+
+Tests are run with PHPUnit/Pest, go test, Jest or pytest, depending on the
+files in the project. After each run a summary lists how many tests passed,
+failed and were skipped, with the message and location of each failure.
+
+PHP tests are run with the test-file target of the Makefile, which gets the
+PHPUnit filter in FILTER and the path of the JUnit report to write in JUNIT:
+
+	test-file:
+		vendor/bin/phpunit --filter '$(FILTER)' --log-junit '$(JUNIT)'
+
+Tests are given by name, or by their suite: a PHP class, a Go package or a
+test file. When several tests have the same name a list to choose from is
+shown, or use the full name like UserTest::testCreate or --pick N to run the
+Nth of them without a terminal. When no test has the name, the tests that
+loosely match it are listed instead: "UCT" finds UserControllerTest and
+"creates users" finds it_creates_users.
+
+The test framework, the directories that are watched, the files that are
+ignored and how long to wait for an editor to finish saving are set in
+evo-cli.yml:
+
+	test_loop:
+	  framework: pytest  # phpunit, pest, go, jest or pytest
+	  watch: [app, src, tests]
+	  ignore: [".*", vendor, node_modules, storage, "*.log"]
+	  debounce: 300ms`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		dirPath := viper.GetString("dir")
 		if dirPath == "" {
@@ -127,114 +164,66 @@ var testloopCmd = &cobra.Command{
 
 		absoluteDirPath, err := filepath.Abs(dirPath)
 		if err != nil {
-			fmt.Println("Error:", err.Error())
-			return
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
+		}
+		adapter, err := testframework.Select(dirPath, viper.GetString("test_loop.framework"), currentProject.MakefilePath)
+		if err != nil {
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
 		}
-		fmt.Println(yellow("Searching for test"), blue(args[0]), yellow("in directory"), blue(absoluteDirPath)+yellow("..."))
+		fmt.Println(yellow("Searching for"), blue(adapter.Name()), yellow("test"), blue(args[0]), yellow("in directory"), blue(absoluteDirPath)+yellow("..."))
 
-		filePath, err := findMatchingFile(dirPath, args[0])
+		matches, exact, err := findTests(adapter, dirPath, args[0])
 		if err != nil {
-			fmt.Println("Error:", err.Error())
-			return
+			fmt.Println(red("Error:"), err)
+			os.Exit(1)
 		}
-		if filePath == "" {
+		if len(matches) == 0 {
 			fmt.Println(red("No match found for:"), blue(args[0]))
+			os.Exit(1)
+		}
+		pick, _ := cmd.Flags().GetInt("pick")
+		match, ok := chooseTest(dirPath, args[0], matches, exact, pick)
+		if !ok {
 			return
 		}
-		testRelativePath, _ := filepath.Rel(dirPath, filePath)
-		testFilter := strings.TrimSpace(args[0])
 
-		fmt.Println(yellow("Running test:"), green(args[0]), "("+color.GreenString(testRelativePath)+")")
-		runTest(dirPath, testFilter)
+		fmt.Println(yellow("Running test:"), green(match.String()), "("+color.GreenString(testLocation(dirPath, match))+")")
 
-		// Start watching directories and running tests on file changes
-		watchAndRunTests(dirPath, testFilter, testRelativePath)
+		session := &testSession{
+			dir:       dirPath,
+			adapter:   adapter,
+			test:      match,
+			watchDirs: viper.GetStringSlice("test_loop.watch"),
+			ignore:    viper.GetStringSlice("test_loop.ignore"),
+			debounce:  viper.GetDuration("test_loop.debounce"),
+		}
+		exitOnFailure(session.Run())
 	},
 }
 
-// func displayRestartMessage(testName, testRelativePath string) {
-// 	fmt.Println(blue("\n[>]"), yellow("Press Enter twice to restart the test"), green(testName), "("+green(testRelativePath)+")")
-// }
-
-func runTest(dirPath, testFilter string) {
-	makefileDirectory := viper.GetString("makefile_path")
-	makeCommand := exec.Command("make", "-C", makefileDirectory, "test-file", "FILTER="+testFilter)
-	makeCommand.Dir = dirPath
-
-	// throw command in a pty cause docker is ass
-	ptmx, err := pty.Start(makeCommand)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return
+// runTest runs the command that runs tests and returns its exit code, and
+// the signal evo received while it ran. label names the tests in the
+// history, stdin is passed on to the tests and output receives a copy of
+// their output. decode, when set, turns the output of the command into the
+// text that is shown.
+func runTest(dirPath, label string, command []string, stdin io.Reader, output io.Writer, decode func(io.Writer) io.WriteCloser) (int, syscall.Signal) {
+	runner := &ptyrun.Runner{Dir: dirPath, Stdin: stdin, Decode: decode}
+	if output != nil {
+		runner.Tee = []io.Writer{output}
 	}
-
-	// Handle pty size.
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGWINCH)
-	go func() {
-		for range ch {
-			if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
-				log.Printf("error resizing pty: %s", err)
-			}
-		}
-	}()
-	ch <- syscall.SIGWINCH                        // Initial resize.
-	defer func() { signal.Stop(ch); close(ch) }() // Cleanup signals when done.
-
-	// set stdin in raw mode. (for ctrl+d and shit)
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		panic(err)
-	}
-	defer func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }() // Best effort.
-
-	// Copy stdin to the pty and the pty to stdout.
-	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
-	_, _ = io.Copy(os.Stdout, ptmx)
+	code := spawn("test "+label, runner, command[0], command[1:]...)
+	return code, runner.Signal
 }
 
 func init() {
 	rootCmd.AddCommand(testloopCmd)
 
 	testloopCmd.Flags().StringP("dir", "d", "", "Directory to search for test files")
-}
-
-func watchAndRunTests(testFilePath, testFilter, testRelativePath string) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal("Failed to create watcher:", err)
-	}
-	defer watcher.Close()
-
-	// Add only the specific test file to the watcher
-	err = watcher.Add(testRelativePath)
-	if err != nil {
-		log.Fatal("Failed to add file to watcher:", err)
-	}
-
-	fmt.Println(green("Watching for changes in file:"), yellow(testRelativePath))
-
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-
-				// Ensure event.Name matches the testFilePath
-				if event.Op&(fsnotify.Write) != 0 {
-					fmt.Println(green("File changed:"), yellow(event.Name))
-					runTest(filepath.Dir(testFilePath), testFilter)
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Println("Watcher error:", err)
-			}
-		}
-	}()
+	testloopCmd.Flags().Int("pick", 0, "Run the Nth test when several match, in the order they are listed")
 
-	<-make(chan bool) // Block indefinitely to keep the watcher running
+	viper.SetDefault("test_loop.watch", []string{"."})
+	viper.SetDefault("test_loop.ignore", defaultWatchIgnore)
+	viper.SetDefault("test_loop.debounce", defaultWatchDebounce)
 }
@@ -0,0 +1,589 @@
+package cmd
+
+import (
+	"bytes"
+	"evo-cli/internal/ansi"
+	"evo-cli/internal/cache"
+	"evo-cli/internal/history"
+	"evo-cli/internal/testframework"
+	"evo-cli/internal/tty"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/term"
+)
+
+// watchScope is what test-loop watches for changes.
+type watchScope int
+
+const (
+	// watchSources reruns the test when a file in the source or test
+	// directories changes.
+	watchSources watchScope = iota
+	// watchTestFile reruns the test only when the test file changes.
+	watchTestFile
+)
+
+func (s watchScope) String() string {
+	if s == watchTestFile {
+		return "test file"
+	}
+	return "sources"
+}
+
+// defaultWatchIgnore are the files and directories that are not watched when
+// test_loop.ignore is not set. Hidden files are caches and editor swap
+// files, like the result cache PHPUnit writes after every run.
+var defaultWatchIgnore = []string{".*", ".git", "vendor", "node_modules", "storage", "bootstrap/cache", "*.log", "*.swp", "*~"}
+
+// defaultWatchDebounce is how long test-loop waits for more changes before
+// rerunning the test when test_loop.debounce is not set.
+const defaultWatchDebounce = 300 * time.Millisecond
+
+// maxSummaryFailures is how many failed tests the summary after a run lists.
+const maxSummaryFailures = 10
+
+// testResult is the outcome of a single test run.
+type testResult struct {
+	code     int
+	duration time.Duration
+	output   string
+	// report is where the test runner was asked to write its report.
+	report string
+	// signal is the signal evo received while the tests ran.
+	signal syscall.Signal
+}
+
+// testSession is a running test-loop. It reruns the test when files change
+// or when asked to with a key press.
+type testSession struct {
+	dir     string
+	adapter testframework.Adapter
+	// reports is the directory the test runner writes its reports to.
+	reports string
+	// test is the test or suite the session runs.
+	test  testframework.Test
+	scope watchScope
+
+	// watchDirs are the directories watched for changes, relative to dir.
+	watchDirs []string
+	// ignore are globs of files and directories that are not watched.
+	ignore []string
+	// debounce is how long to wait for more changes before rerunning.
+	debounce time.Duration
+	// changed is the first file that changed since the last run was
+	// started, debouncing ends when changes fires.
+	changed string
+	changes *time.Timer
+
+	// interactive is set when keys are read from the terminal.
+	interactive bool
+	watcher     *fsnotify.Watcher
+	// running is set while tests run.
+	running bool
+	// input passes key presses on to the running test.
+	input *keyInput
+	// pending are the tests to run once the running tests finished.
+	pending []testframework.Test
+
+	last     *testResult
+	failures []testframework.Test
+	// status tells whether the status line is the last line on screen.
+	status bool
+}
+
+// Run runs the test and keeps rerunning it until the user quits. It returns
+// the exit code evo exits with, which is not zero when it was asked to quit
+// with SIGTERM or SIGHUP while a test ran.
+func (s *testSession) Run() int {
+	var err error
+	s.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println(red("Error:"), "failed to create watcher:", err)
+		os.Exit(1)
+	}
+	defer s.watcher.Close()
+	s.reports, err = os.MkdirTemp("", "evo-test-loop-")
+	if err != nil {
+		fmt.Println(red("Error:"), "failed to create report directory:", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(s.reports)
+	// The reports are created before watching, so they are never watched.
+	if err := s.watch(); err != nil {
+		fmt.Println(red("Error:"), "failed to watch:", err)
+		os.Exit(1)
+	}
+
+	var keys chan byte
+	if term.IsTerminal(int(os.Stdin.Fd())) && !noTTY() {
+		if state, err := tty.Cbreak(int(os.Stdin.Fd())); err == nil {
+			defer func() { _ = term.Restore(int(os.Stdin.Fd()), state) }()
+			s.interactive = true
+			keys = make(chan byte)
+			go readKeys(keys)
+		}
+	}
+
+	// A finished run is reported even when the loop is busy with a key.
+	done := make(chan testResult, 1)
+	s.start([]testframework.Test{s.test}, done)
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return 0
+			}
+			if s.running {
+				s.input.send(key)
+				continue
+			}
+			if !s.handleKey(key, done) {
+				return 0
+			}
+		case result := <-done:
+			if result.signal == syscall.SIGTERM || result.signal == syscall.SIGHUP {
+				// Only Ctrl+C stops just the running test.
+				s.clearStatus()
+				fmt.Println(red(fmt.Sprintf("\nReceived %s, shutting down...", result.signal)))
+				return 128 + int(result.signal)
+			}
+			s.finish(result)
+			if s.pending != nil {
+				tests := s.pending
+				s.pending = nil
+				s.start(tests, done)
+			}
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return 0
+			}
+			s.handleChange(event)
+		case <-s.debounced():
+			s.changes = nil
+			if s.running {
+				s.pending = []testframework.Test{s.test}
+				s.changed = ""
+				continue
+			}
+			s.clearStatus()
+			fmt.Println(green("File changed:"), yellow(relativePath(s.dir, s.changed)))
+			s.changed = ""
+			s.start([]testframework.Test{s.test}, done)
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return 0
+			}
+			s.printLine(red("Watcher error:"), err)
+		}
+	}
+}
+
+// handleKey acts on a key pressed while no test is running, it returns false
+// when the user quits.
+func (s *testSession) handleKey(key byte, done chan testResult) bool {
+	switch key {
+	case 'r', 'R', '\r', '\n':
+		s.start([]testframework.Test{s.test}, done)
+	case 'f', 'F':
+		if len(s.failures) == 0 {
+			s.printLine(yellow("No failed tests to rerun"))
+			break
+		}
+		s.start(s.failures, done)
+	case 'w', 'W':
+		if s.scope == watchTestFile {
+			s.scope = watchSources
+		} else {
+			s.scope = watchTestFile
+		}
+		if err := s.watch(); err != nil {
+			s.printLine(red("Error:"), "failed to watch:", err)
+			break
+		}
+		s.printStatus()
+	case 'c', 'C', 0x0c:
+		fmt.Print("\x1b[H\x1b[2J\x1b[3J")
+		s.status = false
+		s.printStatus()
+	case 'q', 'Q', 0x04:
+		s.clearStatus()
+		fmt.Println()
+		return false
+	case '?', 'h':
+		s.printLine(faint("r/Enter rerun · f rerun failures · w toggle watching the test file or sources · c clear · q quit"))
+	}
+	return true
+}
+
+// handleChange reruns the test once a watched file changed. Editors write a
+// file in several steps, or replace it, so the test is only rerun when no
+// more changes followed for the debounce period.
+func (s *testSession) handleChange(event fsnotify.Event) {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 || s.ignored(event.Name) {
+		return
+	}
+	if s.scope == watchTestFile && filepath.Clean(event.Name) != filepath.Clean(s.test.File) && filepath.Dir(event.Name) != filepath.Clean(s.test.File) {
+		return
+	}
+	if s.scope == watchSources && event.Op&fsnotify.Create != 0 {
+		// Watch directories created after the session started as well.
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			_ = s.addDirectories(event.Name)
+		}
+	}
+
+	if s.changed == "" {
+		s.changed = event.Name
+	}
+	if s.changes == nil {
+		s.changes = time.NewTimer(s.debounce)
+	} else {
+		s.changes.Reset(s.debounce)
+	}
+}
+
+// debounced fires when no more changes followed the last change for the
+// debounce period.
+func (s *testSession) debounced() <-chan time.Time {
+	if s.changes == nil {
+		return nil
+	}
+	return s.changes.C
+}
+
+// watch watches the files of the current scope.
+func (s *testSession) watch() error {
+	for _, path := range s.watcher.WatchList() {
+		_ = s.watcher.Remove(path)
+	}
+	if s.scope == watchTestFile {
+		// Editors save files by replacing them, watch the directory so the
+		// test file is still watched after it was replaced. Suites like Go
+		// packages are directories themselves.
+		if info, err := os.Stat(s.test.File); err == nil && info.IsDir() {
+			return s.watcher.Add(s.test.File)
+		}
+		return s.watcher.Add(filepath.Dir(s.test.File))
+	}
+
+	watched := 0
+	for _, dir := range s.watchDirs {
+		dir = filepath.Join(s.dir, dir)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if err := s.addDirectories(dir); err != nil {
+			return err
+		}
+		watched++
+	}
+	if watched == 0 {
+		return fmt.Errorf("none of the directories to watch exist: %s", strings.Join(s.watchDirs, ", "))
+	}
+	return nil
+}
+
+// addDirectories watches dir and every directory below it that is not
+// ignored.
+func (s *testSession) addDirectories(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if path != dir && s.ignored(path) {
+			return filepath.SkipDir
+		}
+		return s.watcher.Add(path)
+	})
+}
+
+// ignored reports whether path matches one of the ignore globs, either by
+// its name or by its path relative to the project.
+func (s *testSession) ignored(path string) bool {
+	if s.writtenByEvo(path) {
+		return true
+	}
+	name := filepath.Base(path)
+	relative := filepath.ToSlash(relativePath(s.dir, path))
+	for _, pattern := range s.ignore {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, relative); matched {
+			return true
+		}
+		if strings.HasPrefix(relative, pattern+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writtenByEvo reports whether evo itself writes to path while tests run: a
+// recording, the reports of the test runner, or the history, logs and caches
+// in its data and cache directories. Changes to them must not trigger another
+// run.
+func (s *testSession) writtenByEvo(path string) bool {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if _, ok := recordings.Load(absolute); ok {
+		return true
+	}
+	dirs := []string{s.reports}
+	if dir, err := history.Dir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	if dir, err := cache.Dir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if dir, err = filepath.Abs(dir); err == nil && (absolute == dir || strings.HasPrefix(absolute, dir+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// start runs tests in the background, the result is sent to done.
+func (s *testSession) start(tests []testframework.Test, done chan testResult) {
+	s.clearStatus()
+	s.running = true
+	label := s.test.String()
+	if len(tests) != 1 || tests[0] != s.test {
+		var names []string
+		for _, test := range tests {
+			names = append(names, test.String())
+		}
+		label = strings.Join(names, " ")
+		fmt.Println(yellow("Rerunning failed tests:"), green(label))
+	}
+	// A report left by the last run must not be mistaken for the report of
+	// this one when the runner writes none.
+	report := filepath.Join(s.reports, "report")
+	_ = os.Remove(report)
+	command := s.adapter.Command(s.dir, tests, report)
+
+	var stdin io.Reader
+	var input *keyInput
+	if s.interactive {
+		input = newKeyInput()
+		s.input, stdin = input, input
+	}
+	var decode func(io.Writer) io.WriteCloser
+	if decoder, ok := s.adapter.(testframework.Decoder); ok {
+		decode = func(out io.Writer) io.WriteCloser {
+			return decoder.Decode(out, report)
+		}
+	}
+	output := &tailBuffer{limit: 256 * 1024}
+	go func() {
+		start := time.Now()
+		code, sig := runTest(s.dir, label, command, stdin, ansi.NewWriter(output), decode)
+		if input != nil {
+			_ = input.Close()
+		}
+		done <- testResult{code: code, duration: time.Since(start), output: output.String(), report: report, signal: sig}
+	}()
+}
+
+// finish records the result of a test run.
+func (s *testSession) finish(result testResult) {
+	s.input = nil
+	s.running = false
+	s.last = &result
+	results := s.adapter.Results(s.dir, result.output, result.report)
+	s.failures = testframework.FailedTests(results)
+	s.printSummary(results)
+	s.printStatus()
+}
+
+// printSummary shows how many tests passed, failed and were skipped in a
+// run, and where and why the failed tests failed.
+func (s *testSession) printSummary(results []testframework.Result) {
+	if len(results) == 0 {
+		return
+	}
+	failed := testframework.Count(results, testframework.Failed)
+	counts := []string{green(fmt.Sprintf("%d passed", testframework.Count(results, testframework.Passed)))}
+	if failed > 0 {
+		counts = append(counts, red(fmt.Sprintf("%d failed", failed)))
+	}
+	if skipped := testframework.Count(results, testframework.Skipped); skipped > 0 {
+		counts = append(counts, yellow(fmt.Sprintf("%d skipped", skipped)))
+	}
+	s.clearStatus()
+	fmt.Println()
+	fmt.Println(bold("Tests:"), strings.Join(counts, faint(" · ")))
+
+	shown := 0
+	for _, result := range results {
+		if result.Status != testframework.Failed {
+			continue
+		}
+		if shown == maxSummaryFailures {
+			fmt.Println(faint(fmt.Sprintf("  … and %d more", failed-shown)))
+			break
+		}
+		shown++
+		fmt.Println(" ", red("✗"), result.Test.String())
+		if result.Message != "" {
+			fmt.Println("   ", result.Message)
+		}
+		if result.File != "" {
+			location := s.displayPath(result.File)
+			if result.Line > 0 {
+				location += fmt.Sprintf(":%d", result.Line)
+			}
+			fmt.Println("   ", faint(location))
+		}
+	}
+}
+
+// displayPath returns path relative to the project when it is below it.
+func (s *testSession) displayPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	dir, err := filepath.Abs(s.dir)
+	if err != nil {
+		return path
+	}
+	if relative := relativePath(dir, path); !strings.HasPrefix(relative, "..") {
+		return relative
+	}
+	return path
+}
+
+// printStatus shows the test, the result of the last run and what is
+// watched. In an interactive session the line is replaced when it changes.
+func (s *testSession) printStatus() {
+	parts := []string{bold("Test:") + " " + green(s.test.String())}
+	if s.last != nil {
+		result := green("✓ passed")
+		if s.last.code != 0 {
+			result = red(fmt.Sprintf("✗ failed (exit code %d)", s.last.code))
+			if len(s.failures) > 0 {
+				result = red(fmt.Sprintf("✗ %d failed", len(s.failures)))
+			}
+		}
+		parts = append(parts, bold("Last run:")+" "+result+" "+faint("in "+s.last.duration.Round(time.Millisecond).String()))
+	}
+	parts = append(parts, bold("Watching:")+" "+yellow(s.scope.String()))
+
+	line := strings.Join(parts, faint(" · "))
+	if !s.interactive {
+		fmt.Println(line)
+		return
+	}
+	s.clearStatus()
+	fmt.Print(line + faint("  [r]erun [f]ailed [w]atch [c]lear [q]uit"))
+	s.status = true
+}
+
+// clearStatus removes the status line so other output can take its place.
+func (s *testSession) clearStatus() {
+	if s.status {
+		fmt.Print("\r\x1b[K")
+		s.status = false
+	}
+}
+
+// printLine prints a message above the status line.
+func (s *testSession) printLine(a ...any) {
+	showStatus := s.status
+	s.clearStatus()
+	fmt.Println(a...)
+	if showStatus {
+		s.printStatus()
+	}
+}
+
+// readKeys sends the bytes read from stdin to keys, until stdin is closed.
+func readKeys(keys chan<- byte) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		for _, key := range buf[:n] {
+			keys <- key
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// keyInput passes the keys pressed while a test runs on to it. Keys the test
+// does not read are dropped, so a test that ignores its input never blocks
+// the session.
+type keyInput struct {
+	keys   chan byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newKeyInput() *keyInput {
+	return &keyInput{keys: make(chan byte, 64), closed: make(chan struct{})}
+}
+
+// send passes key on without waiting for the test to read it.
+func (k *keyInput) send(key byte) {
+	select {
+	case k.keys <- key:
+	default:
+	}
+}
+
+func (k *keyInput) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	select {
+	case key := <-k.keys:
+		p[0] = key
+		return 1, nil
+	case <-k.closed:
+		return 0, io.EOF
+	}
+}
+
+// Close ends the input once the test exited.
+func (k *keyInput) Close() error {
+	k.once.Do(func() { close(k.closed) })
+	return nil
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n, err := b.Buffer.Write(p)
+	if b.Len() > b.limit {
+		b.Next(b.Len() - b.limit)
+	}
+	return n, err
+}
+
+func relativePath(base, path string) string {
+	if relative, err := filepath.Rel(base, path); err == nil {
+		return relative
+	}
+	return path
+}
@@ -0,0 +1,108 @@
+// Package ansi removes terminal escape sequences from command output, so it
+// can be saved or searched as plain text.
+package ansi
+
+import (
+	"io"
+	"strings"
+)
+
+type state int
+
+const (
+	stateText state = iota
+	stateEscape
+	stateCSI
+	stateString
+	stateStringEscape
+	stateCharset
+	stateCR
+)
+
+// Writer writes the text written to it to another writer with escape
+// sequences and control characters removed. Sequences split across writes
+// are handled, carriage returns end a line like newlines do.
+type Writer struct {
+	w     io.Writer
+	state state
+	buf   []byte
+}
+
+// NewWriter returns a Writer that writes plain text to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Strip returns s without escape sequences and control characters.
+func Strip(s string) string {
+	var b strings.Builder
+	w := NewWriter(&b)
+	_, _ = w.Write([]byte(s))
+	return b.String()
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buf = w.buf[:0]
+	for _, c := range p {
+		switch w.state {
+		case stateCR:
+			// A carriage return on its own starts the line over, like
+			// progress bars do, keep every version of the line.
+			if c == '\r' {
+				continue
+			}
+			w.buf = append(w.buf, '\n')
+			w.state = stateText
+			if c == '\n' {
+				continue
+			}
+			fallthrough
+		case stateText:
+			switch {
+			case c == 0x1b:
+				w.state = stateEscape
+			case c == '\r':
+				w.state = stateCR
+			case c == '\n' || c == '\t' || c >= 0x20 && c != 0x7f:
+				w.buf = append(w.buf, c)
+			}
+		case stateEscape:
+			switch {
+			case c == '[':
+				w.state = stateCSI
+			case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+				w.state = stateString
+			case c == '(' || c == ')' || c == '*' || c == '+' || c == '#' || c == '%':
+				w.state = stateCharset
+			default:
+				w.state = stateText
+			}
+		case stateCSI:
+			if c >= 0x40 && c <= 0x7e {
+				w.state = stateText
+			}
+		case stateString:
+			switch c {
+			case 0x07:
+				w.state = stateText
+			case 0x1b:
+				w.state = stateStringEscape
+			}
+		case stateStringEscape:
+			if c == '\\' {
+				w.state = stateText
+			} else {
+				w.state = stateString
+			}
+		case stateCharset:
+			w.state = stateText
+		}
+	}
+
+	if len(w.buf) > 0 {
+		if _, err := w.w.Write(w.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
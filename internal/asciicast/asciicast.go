@@ -0,0 +1,170 @@
+// Package asciicast records and plays back terminal sessions in the asciicast
+// v2 format used by asciinema.
+package asciicast
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header is the first line of an asciicast v2 file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Writer records everything written to it as output events.
+type Writer struct {
+	mu      sync.Mutex
+	file    *os.File
+	buf     *bufio.Writer
+	start   time.Time
+	pending []byte
+}
+
+// Create starts a new recording at path.
+func Create(path string, header Header) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	header.Version = 2
+	if header.Timestamp == 0 {
+		header.Timestamp = start.Unix()
+	}
+	w := &Writer{file: file, buf: bufio.NewWriter(file), start: start}
+	if err := w.writeLine(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write records p as an output event. Multi-byte characters split across
+// writes are held back until they are complete, since events must be valid
+// UTF-8.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := append(w.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	w.pending = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return len(p), nil
+	}
+
+	elapsed := time.Since(w.start).Seconds()
+	if err := w.writeLine([]any{elapsed, "o", string(data[:cut])}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close flushes the recording to disk.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) > 0 {
+		_ = w.writeLine([]any{time.Since(w.start).Seconds(), "o", string(w.pending)})
+		w.pending = nil
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *Writer) writeLine(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Play writes the output events of the recording in r to out, keeping the
+// original timing divided by speed. Pauses longer than maxIdle are shortened
+// to maxIdle, zero keeps them as recorded.
+func Play(ctx context.Context, r io.Reader, out io.Writer, speed float64, maxIdle time.Duration) (Header, error) {
+	var header Header
+	if speed <= 0 {
+		return header, errors.New("speed must be positive")
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return header, err
+		}
+		return header, errors.New("empty recording")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return header, fmt.Errorf("invalid header: %w", err)
+	}
+	if header.Version != 2 {
+		return header, fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	previous := 0.0
+	for line := 2; scanner.Scan(); line++ {
+		var event []any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			return header, fmt.Errorf("invalid event on line %d", line)
+		}
+		at, ok := event[0].(float64)
+		kind, _ := event[1].(string)
+		data, _ := event[2].(string)
+		if !ok {
+			return header, fmt.Errorf("invalid event time on line %d", line)
+		}
+
+		delay := time.Duration((at - previous) / speed * float64(time.Second))
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		previous = at
+
+		select {
+		case <-ctx.Done():
+			return header, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if kind == "o" {
+			if _, err := io.WriteString(out, data); err != nil {
+				return header, err
+			}
+		}
+	}
+	return header, scanner.Err()
+}
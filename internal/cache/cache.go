@@ -0,0 +1,76 @@
+// Package cache keeps data that is slow to compute, like the targets of a
+// Makefile, in evo's directory under the user cache directory.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// entry is the on-disk representation of a cached value.
+type entry struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Dir returns the directory evo caches data in.
+func Dir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "evo-cli"), nil
+}
+
+// Path returns the file the value for key is cached in, in the directory of
+// kind.
+func Path(kind, key string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, kind, hex.EncodeToString(hash[:8])+".json"), nil
+}
+
+// Read decodes the value cached for key into v. It returns false when there
+// is none, or when it was written with another version.
+func Read(kind, key string, version int, v any) bool {
+	path, err := Path(kind, key)
+	if err != nil {
+		return false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var cached entry
+	if err := json.Unmarshal(content, &cached); err != nil || cached.Version != version {
+		return false
+	}
+	return json.Unmarshal(cached.Data, v) == nil
+}
+
+// Write caches v for key. Failing to is not an error, the value is computed
+// again next time.
+func Write(kind, key string, version int, v any) {
+	path, err := Path(kind, key)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	content, err := json.Marshal(entry{Version: version, Data: data})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, content, 0o644)
+}
@@ -0,0 +1,120 @@
+// Package fuzzy ranks strings against a loosely typed search pattern.
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores awarded for each matched character.
+const (
+	matchScore       = 1
+	consecutiveBonus = 4
+	boundaryBonus    = 6
+	prefixBonus      = 8
+)
+
+// Score reports whether every character of pattern appears in str in order,
+// ignoring case, and how good the match is. Runs of consecutive characters
+// and characters at the start of a word score higher, so "dbm" ranks
+// "db-migrate" above "dashboard-main". Spaces, underscores and dashes in
+// pattern are optional, so "it does x" matches "it_does_x". A pattern made of
+// the first letters of the words of str, like "UCT" for
+// "UserControllerTest", scores as if every letter started a word.
+func Score(pattern, str string) (int, bool) {
+	p := []rune(strings.ToLower(strings.Map(func(r rune) rune {
+		if isSeparator(r) {
+			return -1
+		}
+		return r
+	}, pattern)))
+	if len(p) == 0 {
+		return 0, true
+	}
+
+	runes := []rune(str)
+	lower := []rune(strings.ToLower(str))
+
+	score := 0
+	previous := -2
+	j := 0
+	for i := 0; i < len(lower) && j < len(p); i++ {
+		if lower[i] != p[j] {
+			continue
+		}
+		score += matchScore
+		if i == 0 {
+			score += prefixBonus
+		} else if isBoundary(runes, i) {
+			score += boundaryBonus
+		}
+		if previous == i-1 {
+			score += consecutiveBonus
+		}
+		previous = i
+		j++
+	}
+	if j < len(p) {
+		return 0, false
+	}
+	score = max(score, initialsScore(p, runes))
+
+	// Prefer shorter strings when everything else is equal.
+	return score*100 - len(runes), true
+}
+
+// initialsScore scores pattern as the first letters of the words of str, or
+// returns zero when it is not.
+func initialsScore(pattern, runes []rune) int {
+	if len(pattern) < 2 {
+		return 0
+	}
+	var initials []rune
+	for i, r := range runes {
+		if (unicode.IsLetter(r) || unicode.IsDigit(r)) && (i == 0 || isBoundary(runes, i)) {
+			initials = append(initials, unicode.ToLower(r))
+		}
+	}
+	if len(initials) < len(pattern) || string(initials[:len(pattern)]) != string(pattern) {
+		return 0
+	}
+
+	score := prefixBonus + len(pattern)*(matchScore+boundaryBonus)
+	if len(initials) == len(pattern) {
+		score += consecutiveBonus
+	}
+	return score
+}
+
+func isSeparator(r rune) bool {
+	return r == ' ' || r == '_' || r == '-'
+}
+
+// isBoundary reports whether the rune at i starts a new word.
+func isBoundary(runes []rune, i int) bool {
+	prev, cur := runes[i-1], runes[i]
+	if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
+
+// Match is a candidate that matched a pattern.
+type Match struct {
+	Index int
+	Score int
+}
+
+// Rank returns the candidates matching pattern, best match first. Candidates
+// with the same score keep their original order.
+func Rank(pattern string, candidates []string) []Match {
+	var matches []Match
+	for i, candidate := range candidates {
+		if score, ok := Score(pattern, candidate); ok {
+			matches = append(matches, Match{Index: i, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
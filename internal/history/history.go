@@ -0,0 +1,171 @@
+// Package history keeps a log of the commands evo ran, stored as JSON lines
+// in the user data directory.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// maxEntries is how many entries are kept, older entries are dropped once the
+// history grows past it.
+const maxEntries = 5000
+
+// Entry is a single run of a command.
+type Entry struct {
+	ID int `json:"id"`
+	// Target names what was run, like a make target, "test <filter>" or "cm".
+	Target string `json:"target"`
+	// Command is the command line of the child process.
+	Command []string `json:"command"`
+	// Args are the arguments evo was started with, used to run it again.
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir"`
+	Project  string        `json:"project,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exit_code"`
+}
+
+// Failed reports whether the command exited with a non-zero status.
+func (e Entry) Failed() bool {
+	return e.ExitCode != 0
+}
+
+// ErrNotFound is returned by Find when no entry has the requested ID.
+var ErrNotFound = errors.New("no such history entry")
+
+// Dir returns the directory evo keeps its data in: $XDG_DATA_HOME/evo-cli,
+// falling back to ~/.local/share/evo-cli, or ~/Library/Application Support on
+// macOS.
+func Dir() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "evo-cli"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home, "Library", "Application Support", "evo-cli"), nil
+	}
+	return filepath.Join(home, ".local", "share", "evo-cli"), nil
+}
+
+// Path returns the file the history is stored in.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// Add appends entry to the history and sets its ID. The file is locked while
+// writing, so runs in parallel or from several terminals get their own IDs.
+func Add(entry *Entry) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	entries, err := read(file)
+	if err != nil {
+		return err
+	}
+	entry.ID = 1
+	if len(entries) > 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if len(entries) < maxEntries {
+		_, err = file.Write(append(line, '\n'))
+		return err
+	}
+
+	// Rewrite the file without the oldest entries.
+	var content bytes.Buffer
+	for _, old := range entries[len(entries)-maxEntries+1:] {
+		oldLine, err := json.Marshal(old)
+		if err != nil {
+			return err
+		}
+		content.Write(append(oldLine, '\n'))
+	}
+	content.Write(append(line, '\n'))
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(content.Bytes(), 0)
+	return err
+}
+
+// Load returns every entry in the history, oldest first.
+func Load() ([]Entry, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return read(file)
+}
+
+// Find returns the entry with id.
+func Find(id int) (Entry, error) {
+	entries, err := Load()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// read parses the entries in file, leaving the offset at the end of the
+// file. Lines that cannot be parsed, like a line cut short by a crash, are
+// skipped.
+func read(file *os.File) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,115 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogDir returns the directory the output of each run is saved in.
+func LogDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logs"), nil
+}
+
+// LogPath returns the log file of the entry with id.
+func LogPath(id int) (string, error) {
+	dir, err := LogDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(id)+".log"), nil
+}
+
+// Log is the output of a run that is still being written. The log only gets
+// its final name once the run is in the history, see Save.
+type Log struct {
+	*os.File
+}
+
+// CreateLog starts a new log in the log directory.
+func CreateLog() (*Log, error) {
+	dir, err := LogDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, "run-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &Log{File: file}, nil
+}
+
+// Save closes the log and names it after the history entry with id. With an
+// id of zero, when the run could not be added to the history, the log is
+// thrown away.
+func (l *Log) Save(id int) error {
+	if err := l.Close(); err != nil {
+		os.Remove(l.Name())
+		return err
+	}
+	if id == 0 {
+		return os.Remove(l.Name())
+	}
+	path, err := LogPath(id)
+	if err != nil {
+		os.Remove(l.Name())
+		return err
+	}
+	return os.Rename(l.Name(), path)
+}
+
+// PruneLogs removes all but the keep most recent logs, along with logs left
+// behind by runs that never finished.
+func PruneLogs(keep int) error {
+	dir, err := LogDir()
+	if err != nil {
+		return err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var ids []int
+	for _, file := range files {
+		name := file.Name()
+		if id, err := strconv.Atoi(strings.TrimSuffix(name, ".log")); err == nil && strings.HasSuffix(name, ".log") {
+			ids = append(ids, id)
+			continue
+		}
+		// Runs that are still going write to their temporary log, so only
+		// remove those that were left alone for a day by a crashed evo.
+		if info, err := file.Info(); err == nil && strings.HasSuffix(name, ".tmp") && time.Since(info.ModTime()) > 24*time.Hour {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+	if len(ids) <= keep {
+		return nil
+	}
+
+	sort.Ints(ids)
+	var errs []string
+	for _, id := range ids[:len(ids)-keep] {
+		if err := os.Remove(filepath.Join(dir, strconv.Itoa(id)+".log")); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("could not remove old logs: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
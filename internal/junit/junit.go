@@ -0,0 +1,106 @@
+// Package junit reads the JUnit XML reports test runners write, like the ones
+// of PHPUnit's --log-junit and pytest's --junitxml.
+package junit
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+)
+
+// Case is a single test case of a report.
+type Case struct {
+	Name string
+	// Class is the class of the test as written by PHPUnit and Pest, with
+	// namespace separators, ClassName the dotted name other runners write.
+	Class     string
+	ClassName string
+	File      string
+	Line      int
+	// Failure is set when the test failed or errored.
+	Failure *Failure
+	Skipped bool
+}
+
+// Failure tells why a test failed.
+type Failure struct {
+	Message string
+	Type    string
+	// Text is the body of the failure element, usually the message followed
+	// by a stack trace.
+	Text string
+	// Error is set when the test errored instead of failing an assertion.
+	Error bool
+}
+
+type suite struct {
+	Suites []suite    `xml:"testsuite"`
+	Cases  []testCase `xml:"testcase"`
+}
+
+type testCase struct {
+	Name      string    `xml:"name,attr"`
+	Class     string    `xml:"class,attr"`
+	ClassName string    `xml:"classname,attr"`
+	File      string    `xml:"file,attr"`
+	Line      int       `xml:"line,attr"`
+	Failures  []failure `xml:"failure"`
+	Errors    []failure `xml:"error"`
+	Skipped   *struct{} `xml:"skipped"`
+}
+
+type failure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Parse returns the test cases of the report read from r, which has either a
+// testsuites or a testsuite element at its root.
+func Parse(r io.Reader) ([]Case, error) {
+	var root suite
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	return root.cases(nil), nil
+}
+
+// ParseFile returns the test cases of the report at path.
+func ParseFile(path string) ([]Case, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// cases appends the test cases of s and its nested suites to cases.
+func (s suite) cases(cases []Case) []Case {
+	for _, c := range s.Cases {
+		parsed := Case{
+			Name:      c.Name,
+			Class:     c.Class,
+			ClassName: c.ClassName,
+			File:      c.File,
+			Line:      c.Line,
+			Skipped:   c.Skipped != nil,
+		}
+		switch {
+		case len(c.Failures) > 0:
+			parsed.Failure = c.Failures[0].parse(false)
+		case len(c.Errors) > 0:
+			parsed.Failure = c.Errors[0].parse(true)
+		}
+		cases = append(cases, parsed)
+	}
+	for _, nested := range s.Suites {
+		cases = nested.cases(cases)
+	}
+	return cases
+}
+
+func (f failure) parse(isError bool) *Failure {
+	return &Failure{Message: f.Message, Type: f.Type, Text: strings.TrimSpace(f.Text), Error: isError}
+}
@@ -0,0 +1,514 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MakefileTarget is a single runnable target discovered in a Makefile.
+type MakefileTarget struct {
+	Name          string
+	Description   string
+	Phony         bool
+	File          string
+	Line          int
+	Params        []MakefileParam
+	Group         string
+	Hidden        bool
+	Prerequisites []string
+	Recipe        []string
+}
+
+// MakefileParam is a variable a target reads, declared in the comments above
+// the target as "## @param NAME[:type] [value|value...] [description]".
+type MakefileParam struct {
+	Name        string
+	Type        string
+	Values      []string
+	Description string
+}
+
+// Param types supported in @param annotations.
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+)
+
+// Makefile holds the targets of a Makefile along with every file it pulled in
+// through include directives.
+type Makefile struct {
+	Dir      string
+	Path     string
+	Files    []string
+	Targets  []MakefileTarget
+	Problems []MakefileProblem
+}
+
+// MakefileProblem is something in a Makefile that evo could not make sense of.
+// Problems do not stop the rest of the Makefile from being parsed.
+type MakefileProblem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p MakefileProblem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// ErrNoMakefile is returned when a directory does not contain a Makefile.
+var ErrNoMakefile = errors.New("no Makefile found")
+
+// makefileNames are the file names GNU make looks for, in its lookup order.
+var makefileNames = []string{"GNUmakefile", "makefile", "Makefile"}
+
+var (
+	variablePattern     = regexp.MustCompile(`^(?:override\s+|export\s+|private\s+)*([A-Za-z0-9_.\-]+)\s*(?::{1,3}=|\?=|\+=|!=|=)\s*(.*)$`)
+	referencePattern    = regexp.MustCompile(`\$[({]([A-Za-z0-9_.\-]+)[)}]`)
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	targetNamePattern   = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-]*$`)
+	// conditionalPattern matches the directives of conditional parts, which
+	// may contain a colon, like ifneq (,$(findstring :,$(X))).
+	conditionalPattern = regexp.MustCompile(`^(?:ifeq|ifneq|ifdef|ifndef|else|endif)(?:\s|\(|$)`)
+	// definePattern matches the start of a multi-line variable.
+	definePattern = regexp.MustCompile(`^(?:override\s+|export\s+|private\s+)*define(?:\s|$)`)
+)
+
+// FindMakefile returns the path of the Makefile make would use in dir.
+func FindMakefile(dir string) (string, error) {
+	for _, name := range makefileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w in %s", ErrNoMakefile, dir)
+}
+
+// ParseMakefile scans the Makefile in dir, following includes, and returns the
+// targets it declares. Descriptions are taken from "## description" comments,
+// either at the end of the rule line or on the lines directly above it.
+// A "##@ Section" comment puts the targets that follow it in that section, and
+// targets starting with an underscore or annotated with "## @hidden" are
+// marked as hidden.
+func ParseMakefile(dir string) (*Makefile, error) {
+	if dir == "" {
+		dir = "."
+	}
+	path, err := FindMakefile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &makefileParser{
+		dir:       dir,
+		variables: map[string]string{},
+		phony:     map[string]bool{},
+		index:     map[string]int{},
+		visited:   map[string]bool{},
+	}
+	if err := p.parseFile(path, true); err != nil {
+		return nil, err
+	}
+
+	for i := range p.targets {
+		p.targets[i].Phony = p.phony[p.targets[i].Name]
+	}
+
+	return &Makefile{
+		Dir:      dir,
+		Path:     path,
+		Files:    p.files,
+		Targets:  p.targets,
+		Problems: p.problems,
+	}, nil
+}
+
+// ListMakeTargets asks make itself for the targets of the Makefile in dir by
+// running listTarget, which must print one "name description" pair per line.
+func ListMakeTargets(dir, listTarget string) ([]MakefileTarget, error) {
+	cmd := exec.Command("make", "--no-print-directory", "-C", dir, listTarget)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("make %s: %w", listTarget, err)
+	}
+
+	var targets []MakefileTarget
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			continue
+		}
+		targets = append(targets, MakefileTarget{
+			Name:        parts[0],
+			Description: strings.Join(parts[1:], " "),
+		})
+	}
+	return targets, nil
+}
+
+// selectListedTargets returns the parsed targets that listTarget listed, in
+// the order of the list and with its descriptions. Prerequisites, recipes and
+// annotations are only known for parsed targets, listed targets the parser
+// did not find, like ones generated at runtime, are kept without them.
+func selectListedTargets(parsed, listed []MakefileTarget) []MakefileTarget {
+	byName := make(map[string]MakefileTarget, len(parsed))
+	for _, target := range parsed {
+		byName[target.Name] = target
+	}
+	targets := make([]MakefileTarget, 0, len(listed))
+	for _, target := range listed {
+		if found, ok := byName[target.Name]; ok {
+			found.Description = target.Description
+			target = found
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+type makefileParser struct {
+	dir       string
+	variables map[string]string
+	phony     map[string]bool
+	index     map[string]int
+	visited   map[string]bool
+	files     []string
+	targets   []MakefileTarget
+	problems  []MakefileProblem
+}
+
+func (p *makefileParser) problem(path string, line int, format string, args ...any) {
+	p.problems = append(p.problems, MakefileProblem{File: path, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *makefileParser) parseFile(path string, required bool) error {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if p.visited[absolute] {
+		return nil
+	}
+	p.visited[absolute] = true
+
+	file, err := os.Open(path)
+	if err != nil {
+		if !required && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	p.files = append(p.files, path)
+
+	var (
+		doc      []string
+		group    string
+		inRule   bool
+		rule     []int
+		inDefine bool
+		lineNo   int
+	)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		start := lineNo
+
+		// Join continuation lines.
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			lineNo++
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(scanner.Text())
+		}
+
+		trimmed := strings.TrimSpace(line)
+
+		if inDefine {
+			if strings.HasPrefix(trimmed, "endef") {
+				inDefine = false
+			}
+			continue
+		}
+
+		// Recipe lines belong to the previous rule.
+		if strings.HasPrefix(line, "\t") && inRule {
+			for _, i := range rule {
+				p.targets[i].Recipe = append(p.targets[i].Recipe, strings.TrimPrefix(line, "\t"))
+			}
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			doc = nil
+			continue
+		case strings.HasPrefix(trimmed, "##@"):
+			group = strings.TrimSpace(strings.TrimPrefix(trimmed, "##@"))
+			doc = nil
+			continue
+		case strings.HasPrefix(trimmed, "##"):
+			doc = append(doc, strings.TrimSpace(strings.TrimPrefix(trimmed, "##")))
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			continue
+		case definePattern.MatchString(trimmed):
+			inDefine = true
+			doc = nil
+			continue
+		case conditionalPattern.MatchString(trimmed):
+			// Conditionals neither end a rule nor the comments above the
+			// target they wrap.
+			continue
+		}
+
+		if includes, optional, ok := includeDirective(trimmed); ok {
+			for _, include := range p.expandIncludes(includes, path, start) {
+				if err := p.parseFile(include, !optional); err != nil {
+					p.problem(path, start, "cannot include %s: %v", include, err)
+				}
+			}
+			doc = nil
+			inRule = false
+			continue
+		}
+
+		if match := variablePattern.FindStringSubmatch(trimmed); match != nil && !isRule(trimmed) {
+			p.variables[match[1]] = strings.TrimSpace(stripComment(match[2]))
+			doc = nil
+			inRule = false
+			continue
+		}
+
+		if !isRule(trimmed) {
+			// Directives such as ifeq/else/endif/export and anything we do not
+			// understand are skipped.
+			doc = nil
+			continue
+		}
+
+		inRule = true
+		rule = p.addRule(trimmed, doc, group, path, start)
+		doc = nil
+	}
+	return scanner.Err()
+}
+
+// addRule records the targets of a rule line and returns their indices, so
+// that the recipe lines that follow can be attached to them.
+func (p *makefileParser) addRule(line string, doc []string, group, path string, lineNo int) []int {
+	var (
+		description []string
+		params      []MakefileParam
+		hidden      bool
+	)
+	for _, comment := range doc {
+		if comment == "@hidden" {
+			hidden = true
+			continue
+		}
+		if annotation, ok := strings.CutPrefix(comment, "@param "); ok {
+			if param, ok := parseParam(annotation); ok {
+				params = append(params, param)
+			} else {
+				p.problem(path, lineNo, "invalid annotation %q", "@param "+annotation)
+			}
+			continue
+		}
+		description = append(description, comment)
+	}
+	if i := strings.Index(line, "##"); i >= 0 {
+		description = []string{strings.TrimSpace(line[i+2:])}
+		line = line[:i]
+	}
+
+	colon := ruleColon(line)
+	names := strings.Fields(line[:colon])
+	prerequisites := strings.TrimLeft(line[colon:], ":")
+	if variablePattern.MatchString(strings.TrimSpace(prerequisites)) {
+		// A target-specific variable like "deploy: ENV=prod" names the
+		// target but adds no prerequisites.
+		prerequisites = ""
+	}
+	var recipe []string
+	if i := strings.Index(prerequisites, ";"); i >= 0 {
+		recipe = append(recipe, strings.TrimSpace(prerequisites[i+1:]))
+		prerequisites = prerequisites[:i]
+	}
+
+	var dependencies []string
+	for _, prerequisite := range strings.Fields(p.expand(stripComment(prerequisites))) {
+		// Order-only prerequisites follow a "|", they are still prerequisites.
+		if prerequisite != "|" {
+			dependencies = append(dependencies, prerequisite)
+		}
+	}
+
+	var indices []int
+	for _, name := range names {
+		if name == ".PHONY" {
+			for _, phony := range strings.Fields(stripComment(prerequisites)) {
+				p.phony[p.expand(phony)] = true
+			}
+			continue
+		}
+
+		name = p.expand(name)
+		if strings.Contains(name, "$") {
+			p.problem(path, lineNo, "cannot resolve target name %s", name)
+			continue
+		}
+		if strings.HasPrefix(name, ".") || !targetNamePattern.MatchString(name) {
+			continue
+		}
+
+		if i, ok := p.index[name]; ok {
+			if p.targets[i].Description == "" {
+				p.targets[i].Description = strings.Join(description, " ")
+			}
+			p.targets[i].Params = append(p.targets[i].Params, params...)
+			p.targets[i].Hidden = p.targets[i].Hidden || hidden
+			p.targets[i].Prerequisites = append(p.targets[i].Prerequisites, dependencies...)
+			p.targets[i].Recipe = append(p.targets[i].Recipe, recipe...)
+			indices = append(indices, i)
+			continue
+		}
+		indices = append(indices, len(p.targets))
+		p.index[name] = len(p.targets)
+		p.targets = append(p.targets, MakefileTarget{
+			Name:          name,
+			Description:   strings.Join(description, " "),
+			File:          path,
+			Line:          lineNo,
+			Params:        params,
+			Group:         group,
+			Hidden:        hidden || strings.HasPrefix(name, "_"),
+			Prerequisites: dependencies,
+			Recipe:        recipe,
+		})
+	}
+	return indices
+}
+
+// parseParam parses the part of an @param annotation after the keyword, e.g.
+// "ENV staging|prod Environment to deploy to" or "WORKERS:int Worker count".
+func parseParam(annotation string) (MakefileParam, bool) {
+	fields := strings.Fields(annotation)
+	if len(fields) == 0 {
+		return MakefileParam{}, false
+	}
+
+	param := MakefileParam{Name: fields[0], Type: ParamString}
+	if name, kind, ok := strings.Cut(fields[0], ":"); ok {
+		param.Name, param.Type = name, kind
+	}
+	switch param.Type {
+	case ParamString, ParamInt, ParamBool:
+	default:
+		return MakefileParam{}, false
+	}
+	if !variableNamePattern.MatchString(param.Name) {
+		return MakefileParam{}, false
+	}
+
+	fields = fields[1:]
+	if len(fields) > 0 && strings.Contains(fields[0], "|") {
+		param.Values = strings.Split(fields[0], "|")
+		fields = fields[1:]
+	}
+	param.Description = strings.Join(fields, " ")
+	return param, true
+}
+
+// expand substitutes references to variables defined earlier in the Makefile.
+// Anything it cannot resolve is left untouched.
+func (p *makefileParser) expand(value string) string {
+	for i := 0; i < 10 && strings.Contains(value, "$"); i++ {
+		expanded := referencePattern.ReplaceAllStringFunc(value, func(ref string) string {
+			name := referencePattern.FindStringSubmatch(ref)[1]
+			if v, ok := p.variables[name]; ok {
+				return v
+			}
+			if v, ok := os.LookupEnv(name); ok {
+				return v
+			}
+			return ref
+		})
+		if expanded == value {
+			break
+		}
+		value = expanded
+	}
+	return value
+}
+
+func (p *makefileParser) expandIncludes(value, path string, line int) []string {
+	var paths []string
+	for _, include := range strings.Fields(p.expand(stripComment(value))) {
+		if strings.Contains(include, "$") {
+			p.problem(path, line, "cannot resolve include %s", include)
+			continue
+		}
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(p.dir, include)
+		}
+		if matches, err := filepath.Glob(include); err == nil && len(matches) > 0 {
+			paths = append(paths, matches...)
+			continue
+		}
+		paths = append(paths, include)
+	}
+	return paths
+}
+
+func includeDirective(line string) (string, bool, bool) {
+	for _, directive := range []string{"include", "-include", "sinclude"} {
+		if rest, ok := strings.CutPrefix(line, directive+" "); ok {
+			return rest, directive != "include", true
+		}
+	}
+	return "", false, false
+}
+
+// isRule reports whether line is a rule rather than a variable assignment.
+func isRule(line string) bool {
+	colon := ruleColon(line)
+	if colon < 0 {
+		return false
+	}
+	equals := strings.Index(line, "=")
+	return equals < 0 || colon < equals
+}
+
+// ruleColon returns the index of the colon separating targets from
+// prerequisites, ignoring the ones that are part of ":=" or "::=".
+func ruleColon(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] != ':' {
+			continue
+		}
+		rest := strings.TrimLeft(line[i:], ":")
+		if strings.HasPrefix(rest, "=") {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
+
+func stripComment(value string) string {
+	if i := strings.Index(value, "#"); i >= 0 {
+		return value[:i]
+	}
+	return value
+}
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"evo-cli/internal/cache"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// makefileCacheVersion is bumped whenever the cached data changes shape, so
+// caches written by older versions of evo are rebuilt.
+const makefileCacheVersion = 6
+
+// makefileCache is the on-disk representation of a parsed Makefile.
+type makefileCache struct {
+	Dir        string            `json:"dir"`
+	ListTarget string            `json:"list_target"`
+	Path       string            `json:"path"`
+	Files      []cachedFile      `json:"files"`
+	Targets    []MakefileTarget  `json:"targets"`
+	Problems   []MakefileProblem `json:"problems"`
+}
+
+// cachedFile records the state of a Makefile (or one of its includes) at the
+// time the cache was written.
+type cachedFile struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Hash    string    `json:"hash"`
+}
+
+// LoadMakefile returns the targets of the Makefile in dir, reusing the cached
+// result as long as neither the Makefile nor any of its includes changed.
+// When listTarget is set the targets are listed by running that make target
+// instead of parsing the Makefile.
+func LoadMakefile(dir, listTarget string) (*Makefile, error) {
+	if dir == "" {
+		dir = "."
+	}
+	if c, ok := readMakefileCache(dir, listTarget); ok && c.fresh() {
+		return &Makefile{
+			Dir:      dir,
+			Path:     c.Path,
+			Files:    c.paths(),
+			Targets:  c.Targets,
+			Problems: c.Problems,
+		}, nil
+	}
+	return RefreshMakefile(dir, listTarget)
+}
+
+// RefreshMakefile discovers the targets of the Makefile in dir from scratch
+// and replaces the cached result.
+func RefreshMakefile(dir, listTarget string) (*Makefile, error) {
+	if dir == "" {
+		dir = "."
+	}
+	makefile, err := ParseMakefile(dir)
+	if err != nil {
+		return nil, err
+	}
+	if listTarget != "" {
+		listed, err := ListMakeTargets(dir, listTarget)
+		if err != nil {
+			return nil, err
+		}
+		makefile.Targets = selectListedTargets(makefile.Targets, listed)
+	}
+
+	c := makefileCache{
+		Dir:        dir,
+		ListTarget: listTarget,
+		Path:       makefile.Path,
+		Targets:    makefile.Targets,
+		Problems:   makefile.Problems,
+	}
+	for _, path := range makefile.Files {
+		file, err := snapshotFile(path)
+		if err != nil {
+			return makefile, nil
+		}
+		c.Files = append(c.Files, file)
+	}
+	writeMakefileCache(dir, listTarget, c)
+
+	return makefile, nil
+}
+
+// fresh reports whether every file the cache was built from is unchanged.
+// Files whose modification time moved are hashed before being considered
+// stale, so touching a Makefile does not throw the cache away.
+func (c makefileCache) fresh() bool {
+	if len(c.Files) == 0 {
+		return false
+	}
+	for _, file := range c.Files {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return false
+		}
+		if info.ModTime().Equal(file.ModTime) && info.Size() == file.Size {
+			continue
+		}
+		hash, err := hashFile(file.Path)
+		if err != nil || hash != file.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+func (c makefileCache) paths() []string {
+	paths := make([]string, 0, len(c.Files))
+	for _, file := range c.Files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+func snapshotFile(path string) (cachedFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return cachedFile{}, err
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return cachedFile{}, err
+	}
+	return cachedFile{
+		Path:    path,
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Hash:    hash,
+	}, nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// makefileCacheKey identifies the cache of dir, there is one per Makefile
+// directory and list target.
+func makefileCacheKey(dir, listTarget string) string {
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		absolute = dir
+	}
+	return absolute + "\x00" + listTarget
+}
+
+func readMakefileCache(dir, listTarget string) (makefileCache, bool) {
+	var c makefileCache
+	ok := cache.Read("targets", makefileCacheKey(dir, listTarget), makefileCacheVersion, &c)
+	return c, ok
+}
+
+// writeMakefileCache stores c, the Makefile is parsed again next time when
+// that fails.
+func writeMakefileCache(dir, listTarget string, c makefileCache) {
+	cache.Write("targets", makefileCacheKey(dir, listTarget), makefileCacheVersion, c)
+}
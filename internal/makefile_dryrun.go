@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DryRunStep is a target make would update and the commands it would run.
+type DryRunStep struct {
+	Target   string
+	Reason   string
+	File     string
+	Line     int
+	Commands []string
+}
+
+var (
+	tracePattern     = regexp.MustCompile(`^(.+?):(\d+): (?:target '(.+)' does not exist|update target '(.+)' due to: (.*)|[Mm]ust remake target '(.+)')$`)
+	directoryPattern = regexp.MustCompile(`^make(\[\d+\])?: (Entering|Leaving) directory`)
+)
+
+// DryRun asks make which commands it would run for args, without running
+// them, and groups the commands by the target that needs them. Versions of
+// make older than 4.0, like the one macOS ships, have no --trace, their
+// commands are returned as a single step without a target.
+func DryRun(dir string, args []string) ([]DryRunStep, error) {
+	output, err := dryRun(dir, append([]string{"-n", "--trace"}, args...))
+	if err != nil && unsupportedTrace(output) {
+		output, err = dryRun(dir, append([]string{"-n"}, args...))
+	}
+	if err != nil {
+		return ParseDryRun(output), fmt.Errorf("make -n: %w", err)
+	}
+	return ParseDryRun(output), nil
+}
+
+func dryRun(dir string, args []string) (string, error) {
+	cmd := exec.Command("make", append([]string{"-C", dir}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// unsupportedTrace reports whether make rejected the --trace option.
+func unsupportedTrace(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "--trace") && (strings.Contains(line, "unrecognized") || strings.Contains(line, "unknown") || strings.Contains(line, "illegal")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDryRun parses the output of "make -n --trace".
+func ParseDryRun(output string) []DryRunStep {
+	var steps []DryRunStep
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if directoryPattern.MatchString(line) {
+			continue
+		}
+
+		if match := tracePattern.FindStringSubmatch(line); match != nil {
+			step := DryRunStep{File: match[1]}
+			step.Line, _ = strconv.Atoi(match[2])
+			switch {
+			case match[3] != "":
+				step.Target, step.Reason = match[3], "target does not exist"
+			case match[4] != "" && match[5] == "target does not exist":
+				// make 4.4 gives this reason after "due to:" as well.
+				step.Target, step.Reason = match[4], match[5]
+			case match[4] != "":
+				step.Target, step.Reason = match[4], "newer prerequisites: "+match[5]
+			default:
+				step.Target, step.Reason = match[6], "must be remade"
+			}
+			steps = append(steps, step)
+			continue
+		}
+
+		if len(steps) == 0 {
+			steps = append(steps, DryRunStep{})
+		}
+		steps[len(steps)-1].Commands = append(steps[len(steps)-1].Commands, line)
+	}
+	return steps
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// MakefileGraph maps every target to its prerequisites.
+type MakefileGraph map[string][]string
+
+// NewMakefileGraph builds the prerequisite graph of the parsed targets.
+func NewMakefileGraph(targets []MakefileTarget) MakefileGraph {
+	graph := MakefileGraph{}
+	for _, target := range targets {
+		graph[target.Name] = append(graph[target.Name], target.Prerequisites...)
+	}
+	return graph
+}
+
+// LoadMakeDatabase builds the prerequisite graph from the database printed
+// by "make -pn", which includes rules the native parser cannot see, such as
+// targets generated with $(eval) or pattern rules.
+func LoadMakeDatabase(dir, target string) (MakefileGraph, error) {
+	cmd := exec.Command("make", "-pn", "-C", dir, target)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if len(output) == 0 && err != nil {
+		return nil, fmt.Errorf("make -pn %s: %w", target, err)
+	}
+	return ParseMakeDatabase(string(output)), nil
+}
+
+// ParseMakeDatabase extracts the rules from "make -p" output.
+func ParseMakeDatabase(output string) MakefileGraph {
+	graph := MakefileGraph{}
+	notTarget := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "# Not a target"):
+			notTarget = true
+			continue
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, "\t"):
+			continue
+		case !isRule(line):
+			continue
+		}
+		if notTarget {
+			notTarget = false
+			continue
+		}
+
+		colon := ruleColon(line)
+		name := strings.TrimSpace(line[:colon])
+		if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "%") || strings.Contains(name, " ") {
+			continue
+		}
+		for _, prerequisite := range strings.Fields(strings.TrimLeft(line[colon:], ":")) {
+			if prerequisite != "|" {
+				graph[name] = append(graph[name], prerequisite)
+			}
+		}
+		if _, ok := graph[name]; !ok {
+			graph[name] = nil
+		}
+	}
+	return graph
+}
+
+// Tree renders the prerequisites of root as an indented tree. Targets that
+// were already expanded elsewhere in the tree are not expanded again.
+func (g MakefileGraph) Tree(root string) string {
+	var b strings.Builder
+	b.WriteString(root + "\n")
+	expanded := map[string]bool{root: true}
+	g.writeTree(&b, root, "", map[string]bool{root: true}, expanded)
+	return b.String()
+}
+
+func (g MakefileGraph) writeTree(b *strings.Builder, node, indent string, path, expanded map[string]bool) {
+	children := g[node]
+	for i, child := range children {
+		branch, next := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+
+		switch {
+		case path[child]:
+			b.WriteString(indent + branch + child + " (cycle)\n")
+		case expanded[child] && len(g[child]) > 0:
+			b.WriteString(indent + branch + child + " (see above)\n")
+		default:
+			b.WriteString(indent + branch + child + "\n")
+			expanded[child] = true
+			path[child] = true
+			g.writeTree(b, child, indent+next, path, expanded)
+			delete(path, child)
+		}
+	}
+}
+
+// edges returns every edge reachable from root, in a stable order.
+func (g MakefileGraph) edges(root string) [][2]string {
+	var edges [][2]string
+	seen := map[string]bool{root: true}
+	queue := []string{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, child := range g[node] {
+			edges = append(edges, [2]string{node, child})
+			if !seen[child] {
+				seen[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return edges
+}
+
+// Dot renders the prerequisites of root in Graphviz dot format.
+func (g MakefileGraph) Dot(root string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", root)
+	b.WriteString("  rankdir=LR;\n")
+	fmt.Fprintf(&b, "  %q [shape=box, style=bold];\n", root)
+	for _, edge := range g.edges(root) {
+		fmt.Fprintf(&b, "  %q -> %q;\n", edge[0], edge[1])
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the prerequisites of root as a mermaid flowchart.
+func (g MakefileGraph) Mermaid(root string) string {
+	ids := map[string]string{}
+	var nodes []string
+	id := func(node string) string {
+		if _, ok := ids[node]; !ok {
+			ids[node] = fmt.Sprintf("n%d", len(nodes))
+			nodes = append(nodes, node)
+		}
+		return ids[node]
+	}
+
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+	id(root)
+	for _, edge := range g.edges(root) {
+		fmt.Fprintf(&b, "  %s --> %s\n", id(edge[0]), id(edge[1]))
+	}
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "  %s[%q]\n", ids[node], node)
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+// Package notify tells the user that something finished while they were
+// looking at another window, through the terminal or the desktop.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Channels notifications can be sent through.
+const (
+	// Bell rings the terminal bell.
+	Bell = "bell"
+	// OSC9 is the desktop notification escape sequence of iTerm2, Windows
+	// Terminal, kitty and others.
+	OSC9 = "osc9"
+	// OSC777 is the desktop notification escape sequence of rxvt, foot and
+	// VTE based terminals.
+	OSC777 = "osc777"
+	// NotifySend shows a desktop notification with notify-send.
+	NotifySend = "notify-send"
+)
+
+// Channels lists every known channel.
+var Channels = []string{Bell, OSC9, OSC777, NotifySend}
+
+// Notification is a message about a finished command.
+type Notification struct {
+	Title string
+	Body  string
+	// Failed notifications are shown as urgent where the channel supports it.
+	Failed bool
+}
+
+// Send sends n through each of channels. Escape sequences are written to
+// terminal, they are skipped when it is nil. Channels that are not available,
+// like notify-send when it is not installed, are skipped as well.
+func Send(channels []string, terminal io.Writer, n Notification) error {
+	var errs []error
+	for _, channel := range channels {
+		var err error
+		switch strings.ToLower(channel) {
+		case Bell:
+			err = writeTerminal(terminal, "\a")
+		case OSC9:
+			err = writeTerminal(terminal, "\x1b]9;"+clean(n.Title+": "+n.Body)+"\x07")
+		case OSC777:
+			err = writeTerminal(terminal, "\x1b]777;notify;"+strings.ReplaceAll(clean(n.Title), ";", ",")+";"+clean(n.Body)+"\x07")
+		case NotifySend:
+			err = notifySend(n)
+		default:
+			err = fmt.Errorf("unknown notification channel %q, expected one of %s", channel, strings.Join(Channels, ", "))
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeTerminal(terminal io.Writer, sequence string) error {
+	if terminal == nil {
+		return nil
+	}
+	_, err := io.WriteString(terminal, sequence)
+	return err
+}
+
+func notifySend(n Notification) error {
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		return nil
+	}
+	urgency := "normal"
+	if n.Failed {
+		urgency = "critical"
+	}
+	cmd := exec.Command(path, "--app-name=evo", "--urgency="+urgency, n.Title, n.Body)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("notify-send: %w", err)
+	}
+	return nil
+}
+
+// clean removes control characters, which would end an escape sequence early.
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
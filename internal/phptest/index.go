@@ -0,0 +1,118 @@
+package phptest
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"evo-cli/internal/cache"
+	"evo-cli/internal/walk"
+)
+
+// indexVersion is bumped whenever the cached index changes shape or the
+// parser finds different tests, so indexes written by older versions of evo
+// are rebuilt.
+const indexVersion = 2
+
+// Index holds the test classes found below a set of directories.
+type Index struct {
+	Classes []Class
+}
+
+// indexCache is the on-disk representation of an index.
+type indexCache struct {
+	Files map[string]cachedFile `json:"files"`
+}
+
+// cachedFile records a PHP file at the time it was parsed.
+type cachedFile struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Classes []Class   `json:"classes"`
+}
+
+// Load indexes the PHP files below dirs, directories that do not exist are
+// skipped. Files that did not change since the last index of the same
+// directories are not parsed again.
+func Load(dirs []string) (*Index, error) {
+	cached := readIndexCache(dirs)
+	fresh := indexCache{Files: map[string]cachedFile{}}
+	changed := false
+
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		err := walk.Files(dir, []string{"vendor", "node_modules"}, func(path string, entry fs.DirEntry) error {
+			if !strings.HasSuffix(path, ".php") {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+
+			if file, ok := cached.Files[path]; ok && file.ModTime.Equal(info.ModTime()) && file.Size == info.Size() {
+				fresh.Files[path] = file
+				return nil
+			}
+			classes, err := ParseFile(path)
+			if err != nil {
+				// Unreadable files cannot contain tests we can run.
+				return nil
+			}
+			fresh.Files[path] = cachedFile{ModTime: info.ModTime(), Size: info.Size(), Classes: classes}
+			changed = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if changed || len(fresh.Files) != len(cached.Files) {
+		writeIndexCache(dirs, fresh)
+	}
+
+	index := &Index{}
+	for _, file := range fresh.Files {
+		index.Classes = append(index.Classes, file.Classes...)
+	}
+	sort.Slice(index.Classes, func(i, j int) bool {
+		a, b := index.Classes[i], index.Classes[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return index, nil
+}
+
+// indexCacheKey identifies the cached index of dirs.
+func indexCacheKey(dirs []string) string {
+	var absolute []string
+	for _, dir := range dirs {
+		path, err := filepath.Abs(dir)
+		if err != nil {
+			path = dir
+		}
+		absolute = append(absolute, path)
+	}
+	return strings.Join(absolute, "\x00")
+}
+
+func readIndexCache(dirs []string) indexCache {
+	var index indexCache
+	if !cache.Read("tests", indexCacheKey(dirs), indexVersion, &index) {
+		return indexCache{}
+	}
+	return index
+}
+
+// writeIndexCache stores the index of dirs, the files are parsed again next
+// time when that fails.
+func writeIndexCache(dirs []string, index indexCache) {
+	cache.Write("tests", indexCacheKey(dirs), indexVersion, index)
+}
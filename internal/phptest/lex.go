@@ -0,0 +1,245 @@
+package phptest
+
+import (
+	"bytes"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota + 1
+	tokenVariable
+	tokenString
+	tokenPunct
+	tokenDoc
+	tokenAttribute
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// lex splits PHP source into the tokens the parser needs. Comments other than
+// doc comments, heredocs and inline HTML are dropped, names keep their
+// namespace separators so Foo\Bar is a single token. Quoted strings are kept
+// without their quotes for the descriptions of Pest tests.
+func lex(src []byte) []token {
+	l := &lexer{src: src, line: 1}
+	l.skipHTML()
+	for l.pos < len(l.src) {
+		l.scan()
+	}
+	return l.tokens
+}
+
+type lexer struct {
+	src    []byte
+	pos    int
+	line   int
+	tokens []token
+}
+
+func (l *lexer) emit(kind tokenKind, text string, line int) {
+	l.tokens = append(l.tokens, token{kind: kind, text: text, line: line})
+}
+
+// advance moves past n bytes, counting lines.
+func (l *lexer) advance(n int) {
+	end := min(l.pos+n, len(l.src))
+	l.line += bytes.Count(l.src[l.pos:end], []byte("\n"))
+	l.pos = end
+}
+
+// skipTo moves past the first occurrence of end, or to the end of the source.
+func (l *lexer) skipTo(end string) {
+	i := bytes.Index(l.src[l.pos:], []byte(end))
+	if i < 0 {
+		l.advance(len(l.src) - l.pos)
+		return
+	}
+	l.advance(i + len(end))
+}
+
+// skipHTML moves past everything up to the next <?php or <? tag.
+func (l *lexer) skipHTML() {
+	i := bytes.Index(l.src[l.pos:], []byte("<?"))
+	if i < 0 {
+		l.advance(len(l.src) - l.pos)
+		return
+	}
+	l.advance(i + 2)
+	if bytes.HasPrefix(bytes.ToLower(l.src[l.pos:]), []byte("php")) {
+		l.advance(3)
+	}
+}
+
+func (l *lexer) scan() {
+	c := l.src[l.pos]
+	rest := l.src[l.pos:]
+	line := l.line
+
+	switch {
+	case c == '\n' || c == ' ' || c == '\t' || c == '\r':
+		l.advance(1)
+	case bytes.HasPrefix(rest, []byte("?>")):
+		l.advance(2)
+		l.skipHTML()
+	case bytes.HasPrefix(rest, []byte("/**")) && !bytes.HasPrefix(rest, []byte("/**/")):
+		start := l.pos
+		l.skipTo("*/")
+		l.emit(tokenDoc, string(l.src[start:l.pos]), line)
+	case bytes.HasPrefix(rest, []byte("/*")):
+		l.skipTo("*/")
+	case bytes.HasPrefix(rest, []byte("#[")):
+		start := l.pos
+		l.skipBrackets()
+		l.emit(tokenAttribute, string(l.src[start:l.pos]), line)
+	case c == '#' || bytes.HasPrefix(rest, []byte("//")):
+		l.skipLineComment()
+	case c == '\'' || c == '"' || c == '`':
+		start := l.pos
+		l.skipString(c)
+		l.emit(tokenString, unquote(l.src[start:l.pos]), line)
+	case bytes.HasPrefix(rest, []byte("<<<")):
+		l.skipHeredoc()
+	case c == '$' && l.pos+1 < len(l.src) && isNameStart(l.src[l.pos+1]):
+		start := l.pos
+		l.advance(1)
+		l.advance(l.nameLength(false))
+		l.emit(tokenVariable, string(l.src[start:l.pos]), line)
+	case isNameStart(c) || c == '\\':
+		n := l.nameLength(true)
+		l.emit(tokenIdent, string(rest[:n]), line)
+		l.advance(n)
+	case bytes.HasPrefix(rest, []byte("?->")):
+		l.emit(tokenPunct, "?->", line)
+		l.advance(3)
+	case bytes.HasPrefix(rest, []byte("::")) || bytes.HasPrefix(rest, []byte("->")):
+		l.emit(tokenPunct, string(rest[:2]), line)
+		l.advance(2)
+	default:
+		l.emit(tokenPunct, string(c), line)
+		l.advance(1)
+	}
+}
+
+// nameLength returns the length of the name at the current position, with
+// namespace separators when qualified is set.
+func (l *lexer) nameLength(qualified bool) int {
+	n := 0
+	for l.pos+n < len(l.src) {
+		c := l.src[l.pos+n]
+		if !isNameStart(c) && !(c >= '0' && c <= '9') && !(qualified && c == '\\') {
+			break
+		}
+		n++
+	}
+	return max(n, 1)
+}
+
+// skipLineComment moves to the end of the line, or to a closing ?> tag which
+// ends a line comment as well.
+func (l *lexer) skipLineComment() {
+	for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+		if bytes.HasPrefix(l.src[l.pos:], []byte("?>")) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// skipString moves past a quoted string, honouring backslash escapes.
+func (l *lexer) skipString(quote byte) {
+	l.advance(1)
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.advance(2)
+		case quote:
+			l.advance(1)
+			return
+		default:
+			l.advance(1)
+		}
+	}
+}
+
+// skipBrackets moves past an attribute group, which may contain nested
+// brackets and strings.
+func (l *lexer) skipBrackets() {
+	depth := 0
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case '[':
+			depth++
+			l.advance(1)
+		case ']':
+			depth--
+			l.advance(1)
+			if depth == 0 {
+				return
+			}
+		case '\'', '"':
+			l.skipString(c)
+		default:
+			l.advance(1)
+		}
+	}
+}
+
+// skipHeredoc moves past a heredoc or nowdoc string.
+func (l *lexer) skipHeredoc() {
+	end := bytes.IndexByte(l.src[l.pos:], '\n')
+	if end < 0 {
+		l.advance(len(l.src) - l.pos)
+		return
+	}
+	label := strings.Trim(strings.TrimSpace(string(l.src[l.pos+3:l.pos+end])), `'"`)
+	l.advance(end + 1)
+	if label == "" {
+		return
+	}
+
+	// The string ends at the first line that starts with the label,
+	// possibly indented.
+	for l.pos < len(l.src) {
+		lineEnd := bytes.IndexByte(l.src[l.pos:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(l.src) - l.pos
+		}
+		trimmed := strings.TrimLeft(string(l.src[l.pos:l.pos+lineEnd]), " \t")
+		if strings.HasPrefix(trimmed, label) && (len(trimmed) == len(label) || !isNameStart(trimmed[len(label)]) && !(trimmed[len(label)] >= '0' && trimmed[len(label)] <= '9')) {
+			l.advance(lineEnd - len(trimmed) + len(label))
+			return
+		}
+		l.advance(lineEnd + 1)
+	}
+}
+
+// unquote returns the content of a quoted string with escaped quotes and
+// backslashes resolved, other escapes are kept as written.
+func unquote(quoted []byte) string {
+	if len(quoted) < 2 {
+		return ""
+	}
+	quote := quoted[0]
+	body := quoted[1 : len(quoted)-1]
+	if quoted[len(quoted)-1] != quote {
+		body = quoted[1:]
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && i+1 < len(body) && (body[i+1] == quote || body[i+1] == '\\') {
+			i++
+		}
+		b.WriteByte(body[i])
+	}
+	return b.String()
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
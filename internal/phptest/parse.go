@@ -0,0 +1,277 @@
+// Package phptest finds the PHPUnit and Pest tests in a PHP code base. Files
+// are parsed for namespaces, classes and test methods, and the result is
+// cached so only files that changed are parsed again.
+package phptest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Class is a class that contains tests. The tests of a Pest file are
+// returned as a class named after the file, like Pest names the class it
+// generates, with the descriptions of the tests as methods.
+type Class struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Abstract  bool     `json:"abstract,omitempty"`
+	Pest      bool     `json:"pest,omitempty"`
+	Methods   []Method `json:"methods"`
+}
+
+// FQN returns the fully qualified name of the class.
+func (c Class) FQN() string {
+	if c.Namespace == "" {
+		return c.Name
+	}
+	return c.Namespace + `\` + c.Name
+}
+
+// Method is a test method.
+type Method struct {
+	Name string `json:"name"`
+	Line int    `json:"line"`
+}
+
+// ParseFile returns the classes with tests in the PHP file at path.
+func ParseFile(path string) ([]Class, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	classes := Parse(src)
+	for i := range classes {
+		classes[i].File = path
+		if classes[i].Pest {
+			classes[i].Name = strings.TrimSuffix(filepath.Base(path), ".php")
+		}
+	}
+	return classes, nil
+}
+
+// Parse returns the classes with tests in src. Methods are tests when their
+// name starts with "test", when they have a #[Test] attribute or when their
+// doc comment has a @test annotation. Calls to Pest's test() and it() outside
+// of classes are returned as a single class without a name.
+func Parse(src []byte) []Class {
+	p := &parser{tokens: lex(src)}
+	return p.parse()
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) next() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, true
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) parse() []Class {
+	var (
+		classes   []Class
+		namespace string
+		depth     int
+		// class is the class being parsed, classDepth the depth of its
+		// body.
+		class      *Class
+		classDepth int
+		// Doc comments, attributes and modifiers seen since the last
+		// statement, they belong to the next class or method.
+		doc        string
+		attributes []string
+		modifiers  []string
+		previous   token
+		pest       = Class{Pest: true}
+	)
+	reset := func() {
+		doc, attributes, modifiers = "", nil, nil
+	}
+
+	for {
+		t, ok := p.next()
+		if !ok {
+			break
+		}
+
+		switch {
+		case t.kind == tokenDoc:
+			doc = t.text
+		case t.kind == tokenAttribute:
+			attributes = append(attributes, t.text)
+		case t.kind == tokenPunct && t.text == "{":
+			depth++
+			reset()
+		case t.kind == tokenPunct && t.text == "}":
+			depth--
+			if class != nil && depth < classDepth {
+				classes = append(classes, *class)
+				class = nil
+			}
+			reset()
+		case t.kind == tokenPunct && t.text == ";":
+			reset()
+		case t.kind != tokenIdent:
+			// Other punctuation ends nothing we track.
+		case strings.EqualFold(t.text, "namespace") && depth == 0 && class == nil:
+			if name := p.peek(); name.kind == tokenIdent {
+				namespace = strings.TrimPrefix(name.text, `\`)
+				p.pos++
+			} else {
+				namespace = ""
+			}
+			reset()
+		case class == nil && depth == 0 && (t.text == "test" || t.text == "it") && !isMemberAccess(previous) && p.peek().text == "(":
+			// test('does x', fn () => ...) or it('does x', ...), which Pest
+			// names "it does x".
+			if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokenString {
+				name := p.tokens[p.pos+1].text
+				if t.text == "it" {
+					name = "it " + name
+				}
+				if pest.Line == 0 {
+					pest.Line = t.line
+				}
+				pest.Methods = append(pest.Methods, Method{Name: name, Line: t.line})
+				p.pos += 2
+			}
+		case isModifier(t.text):
+			modifiers = append(modifiers, strings.ToLower(t.text))
+		case strings.EqualFold(t.text, "class") && class == nil && !isMemberAccess(previous) && !strings.EqualFold(previous.text, "new"):
+			name := p.peek()
+			if name.kind != tokenIdent {
+				break
+			}
+			p.pos++
+			class = &Class{Name: name.text, Namespace: namespace, Line: t.line, Abstract: contains(modifiers, "abstract")}
+			// The body starts at the next opening brace.
+			for b, ok := p.next(); ok && !(b.kind == tokenPunct && b.text == "{"); b, ok = p.next() {
+			}
+			depth++
+			classDepth = depth
+			reset()
+		case strings.EqualFold(t.text, "function") && class != nil && depth == classDepth:
+			name := p.peek()
+			if name.kind != tokenIdent {
+				break
+			}
+			p.pos++
+			public := !contains(modifiers, "private") && !contains(modifiers, "protected")
+			if public && !contains(modifiers, "static") && !contains(modifiers, "abstract") && isTest(name.text, doc, attributes) {
+				class.Methods = append(class.Methods, Method{Name: name.text, Line: name.line})
+			}
+			reset()
+		}
+		previous = t
+	}
+	if class != nil {
+		classes = append(classes, *class)
+	}
+	classes = append(classes, pest)
+
+	var withTests []Class
+	for _, class := range classes {
+		if len(class.Methods) > 0 {
+			withTests = append(withTests, class)
+		}
+	}
+	return withTests
+}
+
+// isTest reports whether a method is a test.
+func isTest(name, doc string, attributes []string) bool {
+	if strings.HasPrefix(name, "test") {
+		return true
+	}
+	if strings.Contains(doc, "@test") {
+		for _, line := range strings.Split(doc, "\n") {
+			fields := strings.Fields(strings.TrimLeft(strings.TrimSpace(line), "/*"))
+			if len(fields) > 0 && fields[0] == "@test" {
+				return true
+			}
+		}
+	}
+	for _, attribute := range attributes {
+		for _, name := range attributeNames(attribute) {
+			if name == "Test" || name == `PHPUnit\Framework\Attributes\Test` {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attributeNames returns the names in an attribute group like
+// "#[Test, DataProvider('cases')]".
+func attributeNames(attribute string) []string {
+	body := strings.TrimSuffix(strings.TrimPrefix(attribute, "#["), "]")
+	var names []string
+	depth := 0
+	start := 0
+	for i, r := range body {
+		switch r {
+		case '(', '[':
+			if depth == 0 {
+				names = append(names, strings.TrimSpace(body[start:i]))
+			}
+			depth++
+		case ')', ']':
+			depth--
+			if depth == 0 {
+				start = i + 1
+			}
+		case ',':
+			if depth == 0 {
+				names = append(names, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	names = append(names, strings.TrimSpace(body[start:]))
+
+	var clean []string
+	for _, name := range names {
+		if name = strings.TrimPrefix(name, `\`); name != "" {
+			clean = append(clean, name)
+		}
+	}
+	return clean
+}
+
+// isMemberAccess reports whether t is followed by a member name, so the
+// "class" in Foo::class or $node->class is not a class declaration.
+func isMemberAccess(t token) bool {
+	return t.kind == tokenPunct && (t.text == "::" || t.text == "->" || t.text == "?->")
+}
+
+func isModifier(word string) bool {
+	switch strings.ToLower(word) {
+	case "abstract", "final", "readonly", "public", "protected", "private", "static":
+		return true
+	}
+	return false
+}
+
+func contains(slice []string, value string) bool {
+	for _, s := range slice {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+// Package picker implements an interactive fuzzy finder for the terminal.
+package picker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"evo-cli/internal/fuzzy"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Item is a single entry of the picker.
+type Item struct {
+	Title       string
+	Description string
+	Preview     []string
+}
+
+// ErrCancelled is returned when the picker is closed without a choice.
+var ErrCancelled = errors.New("cancelled")
+
+var (
+	promptStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFE105")).Bold(true)
+	cursorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#FDEB60")).Bold(true)
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("#707070"))
+	previewStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#A0A0A0")).PaddingLeft(2)
+	previewBorder = lipgloss.NewStyle().Foreground(lipgloss.Color("#707070"))
+)
+
+// Pick lets the user fuzzy search items and returns the index of the chosen
+// one. Items are shown in the given order until a search is typed, callers
+// put the most relevant items first.
+func Pick(prompt string, items []Item) (int, error) {
+	if len(items) == 0 {
+		return -1, errors.New("nothing to pick from")
+	}
+
+	m := newModel(prompt, items)
+	result, err := tea.NewProgram(m, tea.WithOutput(os.Stderr)).Run()
+	if err != nil {
+		return -1, err
+	}
+	final := result.(model)
+	if final.chosen < 0 {
+		return -1, ErrCancelled
+	}
+	return final.chosen, nil
+}
+
+type model struct {
+	prompt  string
+	items   []Item
+	query   []rune
+	matches []int
+	cursor  int
+	chosen  int
+	done    bool
+	height  int
+}
+
+func newModel(prompt string, items []Item) model {
+	m := model{prompt: prompt, items: items, chosen: -1, height: 24}
+	m.filter()
+	return m
+}
+
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.done = true
+			return m, tea.Quit
+		case tea.KeyEnter:
+			if len(m.matches) > 0 {
+				m.chosen = m.matches[m.cursor]
+			}
+			m.done = true
+			return m, tea.Quit
+		case tea.KeyUp, tea.KeyCtrlP, tea.KeyShiftTab:
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case tea.KeyDown, tea.KeyCtrlN, tea.KeyTab:
+			if m.cursor < len(m.matches)-1 {
+				m.cursor++
+			}
+		case tea.KeyBackspace:
+			if len(m.query) > 0 {
+				m.query = m.query[:len(m.query)-1]
+				m.filter()
+			}
+		case tea.KeyCtrlU:
+			m.query = nil
+			m.filter()
+		case tea.KeyRunes, tea.KeySpace:
+			m.query = append(m.query, msg.Runes...)
+			m.filter()
+		}
+	}
+	return m, nil
+}
+
+// filter ranks the items against the query. Matches on the title rank above
+// matches that need the description.
+func (m *model) filter() {
+	query := string(m.query)
+	type ranked struct{ index, score int }
+	var results []ranked
+	for i, item := range m.items {
+		if score, ok := fuzzy.Score(query, item.Title); ok {
+			results = append(results, ranked{i, score * 2})
+		} else if score, ok := fuzzy.Score(query, item.Title+" "+item.Description); ok {
+			results = append(results, ranked{i, score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+
+	m.matches = m.matches[:0]
+	for _, result := range results {
+		m.matches = append(m.matches, result.index)
+	}
+	m.cursor = 0
+}
+
+func (m model) View() string {
+	if m.done {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", promptStyle.Render(m.prompt+" >"), string(m.query)+cursorStyle.Render("█"))
+
+	// Keep room for the preview below the list.
+	listHeight := max(3, m.height/2-2)
+	start := 0
+	if m.cursor >= listHeight {
+		start = m.cursor - listHeight + 1
+	}
+	end := min(len(m.matches), start+listHeight)
+	for i := start; i < end; i++ {
+		item := m.items[m.matches[i]]
+		line := titleStyle.Render(item.Title)
+		if item.Description != "" {
+			line += "  " + dimStyle.Render(item.Description)
+		}
+		if i == m.cursor {
+			b.WriteString(cursorStyle.Render("› ") + line + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	fmt.Fprintf(&b, "%s\n", dimStyle.Render(fmt.Sprintf("  %d/%d", len(m.matches), len(m.items))))
+
+	if len(m.matches) > 0 {
+		preview := m.items[m.matches[m.cursor]].Preview
+		if len(preview) > 0 {
+			b.WriteString(previewBorder.Render("──── preview ────") + "\n")
+			limit := max(1, m.height-listHeight-5)
+			for i, line := range preview {
+				if i == limit {
+					b.WriteString(previewStyle.Render("…") + "\n")
+					break
+				}
+				b.WriteString(previewStyle.Render(line) + "\n")
+			}
+		}
+	}
+	return b.String()
+}
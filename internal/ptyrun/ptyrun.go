@@ -0,0 +1,413 @@
+// Package ptyrun runs commands inside a pseudo terminal, so that programs
+// such as docker behave as if they were started from the user's terminal.
+// When evo itself is not attached to a terminal, in CI or with piped input,
+// commands are run with plain pipes instead.
+package ptyrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// Runner describes how a command is run. The zero value runs the command in
+// the current directory, attached to the terminal of the current process.
+type Runner struct {
+	// Dir is the working directory of the command.
+	Dir string
+	// Env is added to the environment of the current process.
+	Env []string
+	// Stdin is copied to the command. When nil the terminal is put in raw
+	// mode and os.Stdin is forwarded, so that keys like Ctrl+D reach the
+	// command unchanged.
+	Stdin io.Reader
+	// Stdout receives the output of the command, os.Stdout when nil.
+	Stdout io.Writer
+	// Tee receives a copy of everything written to Stdout. Errors writing to
+	// Tee are ignored, a full disk should not stop the command.
+	Tee []io.Writer
+	// Decode, when set, returns the writer the output of the command goes
+	// through before it reaches Stdout and Tee as out, for commands that
+	// write a stream of events instead of text. It is closed once the
+	// command exited.
+	Decode func(out io.Writer) io.WriteCloser
+	// Timeout kills the command when it runs for longer, zero means no limit.
+	Timeout time.Duration
+	// Size is the size of the pty. When nil it follows the size of the
+	// terminal.
+	Size *pty.Winsize
+	// NoTTY runs the command with plain pipes instead of a pty.
+	NoTTY bool
+	// Grace is how long the command gets to exit after evo forwarded
+	// SIGINT, SIGTERM or SIGHUP to it, before it is killed. DefaultGrace is
+	// used when zero.
+	Grace time.Duration
+	// Signal is set by Run to the signal evo received while the command
+	// ran, zero when it received none.
+	Signal syscall.Signal
+}
+
+// DefaultGrace is the grace period of a Runner without one.
+const DefaultGrace = 5 * time.Second
+
+// ErrTimeout is returned when the command was killed after Runner.Timeout.
+var ErrTimeout = errors.New("timed out")
+
+// handler is the only receiver of the signals evo forwards to commands.
+var handler signalHandler
+
+// signalHandler passes SIGINT, SIGTERM and SIGHUP on to the running commands,
+// or to the idle function when nothing is running. Deciding both under one
+// lock means a signal is never seen by a command that is about to exit and
+// by the idle function as well.
+type signalHandler struct {
+	once sync.Once
+	mu   sync.Mutex
+	// forwarders receive the signals while commands run.
+	forwarders map[chan syscall.Signal]struct{}
+	idle       func(sig syscall.Signal)
+}
+
+// HandleSignals makes ptyrun the only receiver of SIGINT, SIGTERM and SIGHUP.
+// Signals received while commands run are forwarded to them, and Run returns
+// 128 plus the signal once they exited. idle is called with the signals
+// received while nothing runs. Without HandleSignals evo exits with 128 plus
+// the signal then.
+func HandleSignals(idle func(sig syscall.Signal)) {
+	handler.mu.Lock()
+	handler.idle = idle
+	handler.mu.Unlock()
+	handler.start()
+}
+
+func (h *signalHandler) start() {
+	h.once.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		go h.dispatch(signals)
+	})
+}
+
+func (h *signalHandler) dispatch(signals <-chan os.Signal) {
+	for received := range signals {
+		sig := received.(syscall.Signal)
+		h.mu.Lock()
+		if len(h.forwarders) > 0 {
+			for forwarder := range h.forwarders {
+				select {
+				case forwarder <- sig:
+				default:
+					// The command is killed already.
+				}
+			}
+			h.mu.Unlock()
+			continue
+		}
+		idle := h.idle
+		h.mu.Unlock()
+		if idle == nil {
+			os.Exit(128 + int(sig))
+		}
+		idle(sig)
+	}
+}
+
+// subscribe returns a channel receiving the signals until unsubscribe.
+func (h *signalHandler) subscribe() chan syscall.Signal {
+	h.start()
+	forwarder := make(chan syscall.Signal, 2)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.forwarders == nil {
+		h.forwarders = map[chan syscall.Signal]struct{}{}
+	}
+	h.forwarders[forwarder] = struct{}{}
+	return forwarder
+}
+
+func (h *signalHandler) unsubscribe(forwarder chan syscall.Signal) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.forwarders, forwarder)
+}
+
+// NotifyContext returns a copy of parent that is canceled when evo receives
+// SIGINT, SIGTERM or SIGHUP, for work done by evo itself that has to clean up
+// before it exits. Until stop is called those signals cancel the context
+// instead of going to the idle function of HandleSignals.
+func NotifyContext(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := handler.subscribe()
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		handler.unsubscribe(signals)
+		cancel()
+	}
+}
+
+// Run starts name with args and waits for it to exit. It returns the exit
+// code of the command, commands killed by a signal exit with 128 plus the
+// signal number like they do in a shell. When evo itself received a signal
+// while the command was running, 128 plus that signal is returned instead,
+// so an interrupted command never looks like it succeeded. The error is only
+// set when the command could not be run to completion.
+func (r *Runner) Run(ctx context.Context, name string, args ...string) (int, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = r.Dir
+	if len(r.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.Env...)
+	}
+	// The command leads its own process group, kill the whole group so that
+	// children of make go away as well.
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	if !r.usePty() {
+		return r.runWithPipes(ctx, cmd)
+	}
+
+	// throw command in a pty cause docker is ass
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return -1, err
+	}
+	defer ptmx.Close()
+	// The pty makes the command lead a session of its own, it does not
+	// see the signals sent to evo.
+	stopForwarding := r.forwardSignals(cmd, true)
+
+	if r.Size != nil {
+		if err := pty.Setsize(ptmx, r.Size); err != nil {
+			log.Printf("error resizing pty: %s", err)
+		}
+	} else if isTerminal(os.Stdin) {
+		// Handle pty size.
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGWINCH)
+		go func() {
+			for range ch {
+				if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
+					log.Printf("error resizing pty: %s", err)
+				}
+			}
+		}()
+		ch <- syscall.SIGWINCH                        // Initial resize.
+		defer func() { signal.Stop(ch); close(ch) }() // Cleanup signals when done.
+	}
+
+	stdin := r.Stdin
+	if stdin == nil {
+		// set stdin in raw mode. (for ctrl+d and shit)
+		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return -1, err
+		}
+		defer func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }() // Best effort.
+		stdin = os.Stdin
+	}
+
+	// Copy stdin to the pty and the pty to stdout. The pty reports EIO
+	// instead of EOF once the command exited.
+	go func() { _, _ = io.Copy(ptmx, stdin) }()
+	stdout := r.stdout()
+	defer stdout.Close()
+	_, _ = io.Copy(stdout, ptmx)
+
+	return r.wait(ctx, cmd, stopForwarding)
+}
+
+// runWithPipes runs cmd without a pty, for when there is no terminal to
+// attach it to.
+func (r *Runner) runWithPipes(ctx context.Context, cmd *exec.Cmd) (int, error) {
+	var stdin io.WriteCloser
+	if r.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	} else {
+		// Copy Stdin like for a pty, Wait would wait for the copy to end and
+		// Stdin may only end once the command exited.
+		var err error
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return -1, err
+		}
+	}
+	stdout := r.stdout()
+	defer stdout.Close()
+	cmd.Stdout = stdout
+	cmd.Stderr = stdout
+	// Only a command in the foreground process group may read from a
+	// terminal, so the command gets its own group only without one.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: !isTerminal(os.Stdin)}
+	if !cmd.SysProcAttr.Setpgid {
+		cmd.Cancel = func() error { return cmd.Process.Kill() }
+	}
+
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(stdin, r.Stdin)
+			_ = stdin.Close()
+		}()
+	}
+	return r.wait(ctx, cmd, r.forwardSignals(cmd, cmd.SysProcAttr.Setpgid))
+}
+
+// forwardSignals passes SIGINT, SIGTERM and SIGHUP received by evo on to the
+// command until the returned function is called, which returns the first
+// signal received. The command is killed when it did not exit within the
+// grace period, or when a second signal arrives. ownGroup tells whether the
+// command leads its own process group, when it does the whole group is
+// signalled so children of make get the signal as well. Otherwise the
+// command shares the terminal with evo and already got the SIGINT of Ctrl+C.
+func (r *Runner) forwardSignals(cmd *exec.Cmd, ownGroup bool) func() syscall.Signal {
+	grace := r.Grace
+	if grace <= 0 {
+		grace = DefaultGrace
+	}
+	send := func(sig syscall.Signal) {
+		if ownGroup {
+			_ = syscall.Kill(-cmd.Process.Pid, sig)
+		} else if sig != syscall.SIGINT {
+			_ = cmd.Process.Signal(sig)
+		}
+	}
+
+	signals := handler.subscribe()
+
+	done := make(chan struct{})
+	result := make(chan syscall.Signal, 1)
+	go func() {
+		var (
+			received syscall.Signal
+			kill     <-chan time.Time
+		)
+		for {
+			select {
+			case sig := <-signals:
+				if received != 0 {
+					send(syscall.SIGKILL)
+					continue
+				}
+				received = sig
+				send(received)
+				kill = time.After(grace)
+			case <-kill:
+				send(syscall.SIGKILL)
+			case <-done:
+				result <- received
+				return
+			}
+		}
+	}()
+
+	return func() syscall.Signal {
+		handler.unsubscribe(signals)
+		close(done)
+		return <-result
+	}
+}
+
+// usePty reports whether the command can be run in a pty attached to the
+// terminal, which needs both stdin and stdout to be terminals when they are
+// not replaced.
+func (r *Runner) usePty() bool {
+	if r.NoTTY {
+		return false
+	}
+	if r.Stdin == nil && !isTerminal(os.Stdin) {
+		return false
+	}
+	return r.Stdout != nil || isTerminal(os.Stdout)
+}
+
+// stdout returns the writer the output of the command goes to.
+func (r *Runner) stdout() io.WriteCloser {
+	stdout := r.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	writers := []io.Writer{stdout}
+	for _, tee := range r.Tee {
+		writers = append(writers, ignoreErrors{tee})
+	}
+	if r.Decode != nil {
+		return r.Decode(io.MultiWriter(writers...))
+	}
+	return nopCloser{io.MultiWriter(writers...)}
+}
+
+// nopCloser is a writer with a Close method that does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ignoreErrors is a writer that always succeeds.
+type ignoreErrors struct {
+	w io.Writer
+}
+
+func (w ignoreErrors) Write(p []byte) (int, error) {
+	_, _ = w.w.Write(p)
+	return len(p), nil
+}
+
+func isTerminal(file *os.File) bool {
+	return term.IsTerminal(int(file.Fd()))
+}
+
+// wait waits for cmd and translates how it exited into an exit code.
+func (r *Runner) wait(ctx context.Context, cmd *exec.Cmd, stopForwarding func() syscall.Signal) (int, error) {
+	err := cmd.Wait()
+	if r.Signal = stopForwarding(); r.Signal != 0 {
+		return 128 + int(r.Signal), nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return exitCode(cmd), ErrTimeout
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return exitCode(cmd), fmt.Errorf("%s: %w", cmd.Path, err)
+	}
+	return exitCode(cmd), nil
+}
+
+func exitCode(cmd *exec.Cmd) int {
+	state := cmd.ProcessState
+	if state == nil {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
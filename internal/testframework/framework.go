@@ -0,0 +1,272 @@
+// Package testframework runs the tests of a project with the test framework
+// it uses. Each framework is supported by an Adapter that discovers tests,
+// builds the command that runs them and finds the failed tests in the output
+// of a run.
+package testframework
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"evo-cli/internal/fuzzy"
+	"evo-cli/internal/walk"
+)
+
+// Test is a single test, or a suite of tests when Name is empty.
+type Test struct {
+	// Suite is what contains the test: a PHP class, a Go package or a test
+	// file, depending on the framework.
+	Suite string
+	Name  string
+	File  string
+	Line  int
+}
+
+// String returns the full name of the test, like
+// Tests\Unit\UserTest::testCreate or tests/test_user.py::test_create.
+func (t Test) String() string {
+	if t.Name == "" {
+		return t.Suite
+	}
+	return t.Suite + "::" + t.Name
+}
+
+// Adapter supports a test framework.
+type Adapter interface {
+	// Name is the name of the framework, as used in evo-cli.yml.
+	Name() string
+	// Detect reports whether the project in dir uses the framework.
+	Detect(dir string) bool
+	// Discover returns the suites and tests of the project in dir.
+	Discover(dir string) ([]Test, error)
+	// Command returns the command line that runs tests in dir. Frameworks
+	// that write a report of the results write it to report.
+	Command(dir string, tests []Test, report string) []string
+	// Results returns the results of a run in dir, read from the report or
+	// from the output of the run without escape sequences. When the report
+	// is missing only the failed tests may be known.
+	Results(dir, output, report string) []Result
+}
+
+// Decoder is implemented by adapters whose framework writes a stream of
+// events instead of text. Decode returns the writer the output of a run goes
+// through, it writes the text to show to out and keeps the events in report
+// for Results.
+type Decoder interface {
+	Decode(out io.Writer, report string) io.WriteCloser
+}
+
+// Adapters returns the built-in adapters, in the order they are detected.
+// PHP tests are run with the test-file target of the Makefile in makefile
+// when it is set.
+func Adapters(makefile string) []Adapter {
+	return []Adapter{
+		&PHPUnit{Makefile: makefile},
+		&GoTest{},
+		&Jest{},
+		&Pytest{},
+	}
+}
+
+// Select returns the adapter called name, or the first adapter whose
+// framework the project in dir uses when name is empty. PHPUnit is used when
+// no framework is detected.
+func Select(dir, name, makefile string) (Adapter, error) {
+	adapters := Adapters(makefile)
+	if name != "" {
+		var names []string
+		for _, adapter := range adapters {
+			if strings.EqualFold(adapter.Name(), name) || (name == "pest" && adapter.Name() == "phpunit") {
+				return adapter, nil
+			}
+			names = append(names, adapter.Name())
+		}
+		return nil, fmt.Errorf("unknown test framework %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	for _, adapter := range adapters {
+		if adapter.Detect(dir) {
+			return adapter, nil
+		}
+	}
+	return adapters[0], nil
+}
+
+// Find returns the suites and tests called name, ignoring case. A suite can
+// be given by its full name or by its last parts, like UserTest for
+// Tests\Unit\UserTest, and a test by its name or as Suite::name.
+func Find(tests []Test, name string) []Test {
+	name = strings.TrimPrefix(strings.TrimSpace(name), `\`)
+	suite, testName, qualified := cutLast(name, "::")
+
+	var matches []Test
+	for _, test := range tests {
+		switch {
+		case qualified && test.Name != "":
+			if suiteMatches(test.Suite, suite) && strings.EqualFold(test.Name, testName) {
+				matches = append(matches, test)
+			}
+		case qualified:
+		case test.Name == "":
+			if suiteMatches(test.Suite, name) {
+				matches = append(matches, test)
+			}
+		case strings.EqualFold(test.Name, name):
+			matches = append(matches, test)
+		}
+	}
+	return matches
+}
+
+// Search returns the suites and tests that loosely match pattern, best match
+// first, for when nothing is called pattern exactly. Suites are matched by
+// the last part of their name and tests by their name, unless pattern
+// contains a separator to match the full names.
+func Search(tests []Test, pattern string) []Test {
+	pattern = strings.TrimPrefix(strings.TrimSpace(pattern), `\`)
+	full := strings.ContainsAny(pattern, `\/`)
+	withSuite := strings.Contains(pattern, "::")
+
+	var (
+		candidates []string
+		found      []Test
+	)
+	for _, test := range tests {
+		suite := test.Suite
+		if !full {
+			suite = shortName(suite)
+		}
+		switch {
+		case test.Name == "" && !withSuite:
+			candidates = append(candidates, suite)
+		case test.Name == "":
+			continue
+		case withSuite:
+			candidates = append(candidates, suite+"::"+test.Name)
+		default:
+			candidates = append(candidates, test.Name)
+		}
+		found = append(found, test)
+	}
+
+	var matches []Test
+	for _, match := range fuzzy.Rank(pattern, candidates) {
+		matches = append(matches, found[match.Index])
+	}
+	return matches
+}
+
+// suiteMatches reports whether name is the full name of suite or its last
+// parts.
+func suiteMatches(suite, name string) bool {
+	suite, name = strings.ToLower(suite), strings.ToLower(strings.TrimPrefix(name, `\`))
+	if suite == name {
+		return true
+	}
+	for _, separator := range []string{`\`, "/", "::"} {
+		if strings.HasSuffix(suite, separator+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortName returns the last part of a suite name.
+func shortName(suite string) string {
+	if i := strings.LastIndexAny(suite, `\/`); i >= 0 {
+		suite = suite[i+1:]
+	}
+	if i := strings.LastIndex(suite, "::"); i >= 0 {
+		suite = suite[i+2:]
+	}
+	return suite
+}
+
+func cutLast(s, separator string) (string, string, bool) {
+	i := strings.LastIndex(s, separator)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(separator):], true
+}
+
+// walkFiles calls walk.Files with the path of every file relative to dir.
+func walkFiles(dir string, skip []string, fn func(path string) error) error {
+	return walk.Files(dir, skip, func(path string, _ fs.DirEntry) error {
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(relative))
+	})
+}
+
+// exists reports whether any of the files exists in dir.
+func exists(dir string, files ...string) bool {
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fileContains reports whether the file in dir contains s.
+func fileContains(dir, file, s string) bool {
+	content, err := os.ReadFile(filepath.Join(dir, file))
+	return err == nil && strings.Contains(string(content), s)
+}
+
+// suites returns the distinct suites of tests, in order.
+func suites(tests []Test) []string {
+	var names []string
+	for _, test := range tests {
+		if !contains(names, test.Suite) {
+			names = append(names, test.Suite)
+		}
+	}
+	return names
+}
+
+// sortTests orders tests by file and line.
+func sortTests(tests []Test) {
+	sort.SliceStable(tests, func(i, j int) bool {
+		if tests[i].File != tests[j].File {
+			return tests[i].File < tests[j].File
+		}
+		return tests[i].Line < tests[j].Line
+	})
+}
+
+// containsTest reports whether tests contains test.
+func containsTest(tests []Test, test Test) bool {
+	for _, t := range tests {
+		if t == test {
+			return true
+		}
+	}
+	return false
+}
+
+// containsSuite reports whether tests contains the suite itself.
+func containsSuite(tests []Test, suite string) bool {
+	for _, test := range tests {
+		if test.Suite == suite && test.Name == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(slice []string, value string) bool {
+	for _, s := range slice {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package testframework
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// goTestFunc matches the declaration of a test function.
+	goTestFunc = regexp.MustCompile(`(?m)^func (Test\w*)\(\w+ \*testing\.T\)`)
+	// goLog matches a message logged by a test, like
+	// "    user_test.go:12: got 1, want 2".
+	goLog = regexp.MustCompile(`^\s+(\w[\w.-]*\.go):(\d+): (.*)$`)
+)
+
+// GoTest runs Go tests with go test. Suites are packages, given as a
+// directory like ./internal/fuzzy or as an import path. go test -json prints
+// events, the output they carry is shown and the results are read from the
+// events kept in the report.
+type GoTest struct{}
+
+// goEvent is an event of go test -json, see go doc test2json.
+type goEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+func (a *GoTest) Name() string {
+	return "go"
+}
+
+func (a *GoTest) Detect(dir string) bool {
+	return exists(dir, "go.mod")
+}
+
+func (a *GoTest) Discover(dir string) ([]Test, error) {
+	var tests []Test
+	err := walkFiles(dir, []string{"vendor", "testdata", "node_modules"}, func(file string) error {
+		if !strings.HasSuffix(file, "_test.go") {
+			return nil
+		}
+		src, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil
+		}
+
+		pkg := "./" + path.Dir(file)
+		if path.Dir(file) == "." {
+			pkg = "."
+		}
+		if !containsSuite(tests, pkg) {
+			tests = append(tests, Test{Suite: pkg, File: filepath.Join(dir, path.Dir(file))})
+		}
+		for _, match := range goTestFunc.FindAllSubmatchIndex(src, -1) {
+			name := string(src[match[2]:match[3]])
+			// TestFoo and Test are tests, Testfoo is not.
+			if len(name) > 4 && name[4] >= 'a' && name[4] <= 'z' {
+				continue
+			}
+			line := 1 + strings.Count(string(src[:match[0]]), "\n")
+			tests = append(tests, Test{Suite: pkg, Name: name, File: filepath.Join(dir, file), Line: line})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortTests(tests)
+	return tests, nil
+}
+
+func (a *GoTest) Command(dir string, tests []Test, report string) []string {
+	command := []string{"go", "test", "-json"}
+	var names []string
+	for _, test := range tests {
+		if name := regexp.QuoteMeta(test.Name); name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		command = append(command, "-run", "^("+strings.Join(names, "|")+")$")
+	}
+	for _, pkg := range suites(tests) {
+		if pkg == "" {
+			pkg = "./..."
+		}
+		command = append(command, pkg)
+	}
+	return command
+}
+
+func (a *GoTest) Decode(out io.Writer, report string) io.WriteCloser {
+	// Without a report the output is still shown, Results only finds none.
+	file, _ := os.Create(report)
+	return &goEventWriter{out: out, report: file}
+}
+
+func (a *GoTest) Results(dir, output, report string) []Result {
+	file, err := os.Open(report)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var (
+		results []Result
+		// logged is the last message logged by each test, subtests log
+		// for their test.
+		logged  = map[string]Result{}
+		scanner = bufio.NewScanner(file)
+	)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		var event goEvent
+		if json.Unmarshal(scanner.Bytes(), &event) != nil || event.Test == "" {
+			continue
+		}
+		name, _, subtest := strings.Cut(event.Test, "/")
+		key := event.Package + " " + name
+		switch event.Action {
+		case "output":
+			if match := goLog.FindStringSubmatch(strings.TrimRight(event.Output, "\n")); match != nil {
+				number, _ := strconv.Atoi(match[2])
+				logged[key] = Result{Message: match[3], File: match[1], Line: number}
+			}
+		case "pass", "fail", "skip":
+			// Subtests count as part of their test.
+			if subtest {
+				continue
+			}
+			result := Result{Test: Test{Suite: event.Package, Name: name}}
+			switch event.Action {
+			case "fail":
+				log := logged[key]
+				result.Status, result.Message, result.File, result.Line = Failed, log.Message, log.File, log.Line
+			case "skip":
+				result.Status = Skipped
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// goEventWriter writes the output of the events go test -json prints to out
+// and appends the events to report. Lines that are no event, like the errors
+// of a package that does not build, are written to out as they are.
+type goEventWriter struct {
+	out     io.Writer
+	report  *os.File
+	pending []byte
+}
+
+func (w *goEventWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := w.pending[:i]
+		w.pending = w.pending[i+1:]
+		if err := w.writeLine(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Close writes the last line when it did not end with a newline and closes
+// the report.
+func (w *goEventWriter) Close() error {
+	var err error
+	if len(w.pending) > 0 {
+		err = w.writeLine(w.pending)
+		w.pending = nil
+	}
+	if w.report != nil {
+		_ = w.report.Close()
+	}
+	return err
+}
+
+func (w *goEventWriter) writeLine(line []byte) error {
+	// A pty ends lines with \r\n, the output of the events is written with
+	// the same line endings.
+	newline := "\n"
+	if trimmed, ok := bytes.CutSuffix(line, []byte("\r")); ok {
+		line, newline = trimmed, "\r\n"
+	}
+	var event goEvent
+	if json.Unmarshal(line, &event) != nil || event.Action == "" {
+		_, err := io.WriteString(w.out, string(line)+newline)
+		return err
+	}
+	if w.report != nil {
+		_, _ = w.report.Write(append(line, '\n'))
+	}
+	_, err := io.WriteString(w.out, strings.ReplaceAll(event.Output, "\n", newline))
+	return err
+}
@@ -0,0 +1,175 @@
+package testframework
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"evo-cli/internal/ansi"
+)
+
+var (
+	// jestTestFile matches the files Jest runs by default.
+	jestTestFile = regexp.MustCompile(`(^|/)__tests__/.*\.[cm]?[jt]sx?$|\.(test|spec)\.[cm]?[jt]sx?$`)
+	// jestTest matches a call to test() or it(), with the title in one of
+	// the three kinds of quotes.
+	jestTest = regexp.MustCompile(`(?m)^\s*(?:it|test)(?:\.(?:only|skip|concurrent|failing))?\(\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)"|` + "`([^`]*)`" + `)`)
+	// jestEscape matches an escaped character in a title.
+	jestEscape = regexp.MustCompile(`\\(.)`)
+	// jestFile matches the line Jest prints for a test file with failures,
+	// like "FAIL src/user.test.js".
+	jestFile = regexp.MustCompile(`^\s*FAIL\s+(\S+)`)
+	// jestFailure matches the heading of a failed test, like
+	// "● users › creates a user".
+	jestFailure = regexp.MustCompile(`^\s*● (.+)$`)
+)
+
+// Jest runs JavaScript and TypeScript tests with Jest. Suites are test files.
+// The results are read from the JSON report Jest writes with --json, it has
+// no JUnit reporter built in.
+type Jest struct{}
+
+// jestReport is the part of Jest's JSON report the results are read from.
+type jestReport struct {
+	TestResults []struct {
+		Name             string `json:"name"`
+		AssertionResults []struct {
+			Title           string   `json:"title"`
+			Status          string   `json:"status"`
+			FailureMessages []string `json:"failureMessages"`
+			Location        *struct {
+				Line int `json:"line"`
+			} `json:"location"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+func (a *Jest) Name() string {
+	return "jest"
+}
+
+func (a *Jest) Detect(dir string) bool {
+	return exists(dir, "jest.config.js", "jest.config.ts", "jest.config.mjs", "jest.config.cjs", "jest.config.json") ||
+		fileContains(dir, "package.json", `"jest"`)
+}
+
+func (a *Jest) Discover(dir string) ([]Test, error) {
+	var tests []Test
+	err := walkFiles(dir, []string{"node_modules", "vendor", "dist", "build", "coverage"}, func(file string) error {
+		if !jestTestFile.MatchString(file) {
+			return nil
+		}
+		src, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil
+		}
+		tests = append(tests, Test{Suite: file, File: filepath.Join(dir, file), Line: 1})
+		for _, match := range jestTest.FindAllSubmatchIndex(src, -1) {
+			var title string
+			for group := 1; group <= 3; group++ {
+				if match[2*group] >= 0 {
+					title = jestEscape.ReplaceAllString(string(src[match[2*group]:match[2*group+1]]), "$1")
+				}
+			}
+			line := 1 + strings.Count(string(src[:match[0]]), "\n")
+			tests = append(tests, Test{Suite: file, Name: title, File: filepath.Join(dir, file), Line: line})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tests, nil
+}
+
+func (a *Jest) Command(dir string, tests []Test, report string) []string {
+	command := []string{"npx", "jest", "--json", "--outputFile=" + report, "--testLocationInResults"}
+	var names []string
+	for _, test := range tests {
+		if name := regexp.QuoteMeta(test.Name); name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, file := range suites(tests) {
+		if file != "" {
+			command = append(command, file)
+		}
+	}
+	if len(names) > 0 {
+		command = append(command, "-t", strings.Join(names, "|"))
+	}
+	return command
+}
+
+func (a *Jest) Results(dir, output, report string) []Result {
+	content, err := os.ReadFile(report)
+	var parsed jestReport
+	if err == nil {
+		err = json.Unmarshal(content, &parsed)
+	}
+	if err != nil {
+		return failedResults(jestFailures(output))
+	}
+
+	// Jest reports absolute paths, suites are relative to the project.
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		absolute = dir
+	}
+	var results []Result
+	for _, file := range parsed.TestResults {
+		suite := file.Name
+		if relative, err := filepath.Rel(absolute, file.Name); err == nil && !strings.HasPrefix(relative, "..") {
+			suite = filepath.ToSlash(relative)
+		}
+		for _, assertion := range file.AssertionResults {
+			result := Result{Test: Test{Suite: suite, Name: assertion.Title, File: file.Name}}
+			if assertion.Location != nil {
+				result.Test.Line = assertion.Location.Line
+			}
+			switch assertion.Status {
+			case "passed":
+			case "failed":
+				result.Status = Failed
+				message := ansi.Strip(strings.Join(assertion.FailureMessages, "\n"))
+				result.Message = firstLine(message, nil)
+				result.locate(message)
+			default:
+				// Skipped, pending, todo and disabled tests.
+				result.Status = Skipped
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// jestFailures returns the tests Jest lists as failed in output.
+func jestFailures(output string) []Test {
+	var (
+		failures []Test
+		file     string
+	)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := jestFile.FindStringSubmatch(line); match != nil {
+			file = match[1]
+			continue
+		}
+		match := jestFailure.FindStringSubmatch(line)
+		if match == nil || strings.HasPrefix(match[1], "Test suite failed to run") || strings.HasPrefix(match[1], "Console") {
+			continue
+		}
+		// Titles of describe blocks come first, the test is the last part.
+		parts := strings.Split(match[1], " › ")
+		failure := Test{Suite: file, Name: strings.TrimSpace(parts[len(parts)-1])}
+		if !containsTest(failures, failure) {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,180 @@
+package testframework
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"evo-cli/internal/junit"
+	"evo-cli/internal/phptest"
+)
+
+// phpTestDirectories are the directories PHP tests are discovered in.
+var phpTestDirectories = []string{"testing", "tests"}
+
+var (
+	// phpunitFailure matches the numbered failures PHPUnit prints after a
+	// run, like "1) Tests\Unit\UserTest::testName".
+	phpunitFailure = regexp.MustCompile(`(?m)^\d+\) ([\w\\]+)::(\w+)`)
+	// pestFailure matches the failures Pest prints after a run, like
+	// "FAILED  Tests\Feature\UserTest > it creates users".
+	pestFailure = regexp.MustCompile(`(?m)^\s*FAILED\s+([\w\\]+)\s+>\s+(.+?)\s*$`)
+	// dataSet matches the name PHPUnit reports for a run of a test with a
+	// data provider, like `testCreate with data set #0` or
+	// `testCreate with data set "admin"`.
+	dataSet = regexp.MustCompile(`^(\w+) with data set (?:#(\d+)|"(.*)")$`)
+)
+
+// PHPUnit runs PHPUnit and Pest tests. Suites are test classes, or test files
+// for Pest.
+type PHPUnit struct {
+	// Makefile is the directory of the Makefile whose test-file target runs
+	// the tests, with the filter in FILTER and the path of the JUnit report
+	// to write in JUNIT. The test runner in vendor/bin is run directly when
+	// it is empty.
+	Makefile string
+}
+
+func (a *PHPUnit) Name() string {
+	return "phpunit"
+}
+
+func (a *PHPUnit) Detect(dir string) bool {
+	return exists(dir, "phpunit.xml", "phpunit.xml.dist", "tests/Pest.php")
+}
+
+func (a *PHPUnit) Discover(dir string) ([]Test, error) {
+	var dirs []string
+	for _, testDir := range phpTestDirectories {
+		dirs = append(dirs, filepath.Join(dir, testDir))
+	}
+	index, err := phptest.Load(dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []Test
+	for _, class := range index.Classes {
+		if class.Abstract {
+			continue
+		}
+		tests = append(tests, Test{Suite: class.FQN(), File: class.File, Line: class.Line})
+		for _, method := range class.Methods {
+			tests = append(tests, Test{Suite: class.FQN(), Name: method.Name, File: class.File, Line: method.Line})
+		}
+	}
+	return tests, nil
+}
+
+func (a *PHPUnit) Command(dir string, tests []Test, report string) []string {
+	var filters []string
+	for _, test := range tests {
+		if filter := phpFilter(dir, test); !contains(filters, filter) {
+			filters = append(filters, filter)
+		}
+	}
+	filter := strings.Join(filters, "|")
+
+	if a.Makefile != "" {
+		// make expands variables given on its command line as well.
+		filter = strings.ReplaceAll(filter, "$", "$$")
+		return []string{"make", "-C", a.Makefile, "test-file", "FILTER=" + filter, "JUNIT=" + report}
+	}
+	runner := "vendor/bin/phpunit"
+	if exists(dir, "vendor/bin/pest") {
+		runner = "vendor/bin/pest"
+	}
+	return []string{runner, "--filter", filter, "--log-junit", report}
+}
+
+func (a *PHPUnit) Results(dir, output, report string) []Result {
+	cases, err := junit.ParseFile(report)
+	if err != nil {
+		// The test-file target of the Makefile may not pass the report on.
+		return failedResults(phpFailures(output))
+	}
+
+	var results []Result
+	for _, c := range cases {
+		suite := c.Class
+		if suite == "" {
+			suite = strings.ReplaceAll(c.ClassName, ".", `\`)
+		}
+		// Pest names the test in the file attribute as well.
+		file, _, _ := strings.Cut(c.File, "::")
+		result := Result{Test: Test{Suite: suite, Name: c.Name, File: file, Line: c.Line}}
+		switch {
+		case c.Failure != nil:
+			result.Status = Failed
+			// The text starts with the name of the test, then the message
+			// and ends with the stack trace.
+			name := result.Test.String()
+			result.Message = firstLine(c.Failure.Text, func(line string) bool {
+				return strings.HasPrefix(line, name)
+			})
+			if result.Message == "" {
+				result.Message = c.Failure.Type
+			}
+			result.locate(c.Failure.Text)
+		case c.Skipped:
+			result.Status = Skipped
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// phpFailures returns the tests PHPUnit or Pest list as failed in output.
+func phpFailures(output string) []Test {
+	var failures []Test
+	matches := phpunitFailure.FindAllStringSubmatch(output, -1)
+	matches = append(matches, pestFailure.FindAllStringSubmatch(output, -1)...)
+	for _, match := range matches {
+		failure := Test{Suite: match[1], Name: match[2]}
+		if !containsTest(failures, failure) {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// phpFilter returns the filter that runs test in the form PHPUnit documents
+// it, Tests\\Unit\\UserTest for a class and Tests\\Unit\\UserTest::testCreate
+// for a method, with the namespace separators escaped for the regexp the
+// filter is. The tests of a Pest file are filtered by their description,
+// quoted to match it literally.
+func phpFilter(dir string, test Test) string {
+	if test.Name != "" && isPest(dir, test.File) {
+		return regexp.QuoteMeta(test.Name)
+	}
+	filter := strings.ReplaceAll(test.Suite, `\`, `\\`)
+	if test.Name == "" {
+		return filter
+	}
+	// A single data set is filtered as testCreate#0 or testCreate@admin.
+	if match := dataSet.FindStringSubmatch(test.Name); match != nil {
+		if match[2] != "" {
+			return filter + "::" + match[1] + "#" + match[2]
+		}
+		return filter + "::" + match[1] + "@" + regexp.QuoteMeta(match[3])
+	}
+	return filter + "::" + test.Name
+}
+
+// isPest reports whether the tests in file are written with Pest's test()
+// and it() instead of in a class.
+func isPest(dir, file string) bool {
+	if file == "" {
+		return false
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	classes, _ := phptest.ParseFile(file)
+	for _, class := range classes {
+		if class.Pest {
+			return true
+		}
+	}
+	return false
+}
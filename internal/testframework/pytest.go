@@ -0,0 +1,158 @@
+package testframework
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"evo-cli/internal/junit"
+)
+
+var (
+	// pytestFile matches the files pytest collects tests from by default.
+	pytestFile = regexp.MustCompile(`(^|/)(test_[^/]*|[^/]*_test)\.py$`)
+	// pytestClass matches the declaration of a test class.
+	pytestClass = regexp.MustCompile(`^class (Test\w*)\b`)
+	// pytestFunc matches the declaration of a test function or method.
+	pytestFunc = regexp.MustCompile(`^(\s*)(?:async\s+)?def (test\w*)\s*\(`)
+	// pytestFailure matches a failed test in the short test summary, like
+	// "FAILED tests/test_user.py::test_create - assert 1 == 2".
+	pytestFailure = regexp.MustCompile(`^(?:FAILED|ERROR) (.+?)(?: - .*)?$`)
+)
+
+// Pytest runs Python tests with pytest. Suites are test files and the test
+// classes in them, like tests/test_user.py::TestUser. The results are read
+// from the JUnit report written with --junitxml, in the xunit1 flavour that
+// tells the file and line of each test.
+type Pytest struct{}
+
+func (a *Pytest) Name() string {
+	return "pytest"
+}
+
+func (a *Pytest) Detect(dir string) bool {
+	return exists(dir, "pytest.ini", "conftest.py") ||
+		fileContains(dir, "pyproject.toml", "pytest") ||
+		fileContains(dir, "setup.cfg", "pytest") ||
+		fileContains(dir, "tox.ini", "pytest")
+}
+
+func (a *Pytest) Discover(dir string) ([]Test, error) {
+	var tests []Test
+	err := walkFiles(dir, []string{"venv", "node_modules", "__pycache__", "site-packages", "build", "dist"}, func(file string) error {
+		if !pytestFile.MatchString(file) {
+			return nil
+		}
+		content, err := os.Open(filepath.Join(dir, file))
+		if err != nil {
+			return nil
+		}
+		defer content.Close()
+
+		path := filepath.Join(dir, file)
+		tests = append(tests, Test{Suite: file, File: path, Line: 1})
+		// class is the test class being read, methodIndent the indentation
+		// of its methods.
+		class, methodIndent := "", ""
+		scanner := bufio.NewScanner(content)
+		for number := 1; scanner.Scan(); number++ {
+			line := scanner.Text()
+			if match := pytestClass.FindStringSubmatch(line); match != nil {
+				class, methodIndent = file+"::"+match[1], ""
+				tests = append(tests, Test{Suite: class, File: path, Line: number})
+				continue
+			}
+			if match := pytestFunc.FindStringSubmatch(line); match != nil {
+				switch {
+				case match[1] == "":
+					class = ""
+					tests = append(tests, Test{Suite: file, Name: match[2], File: path, Line: number})
+				case class != "" && (methodIndent == "" || match[1] == methodIndent):
+					// Functions nested in methods are not tests.
+					methodIndent = match[1]
+					tests = append(tests, Test{Suite: class, Name: match[2], File: path, Line: number})
+				}
+				continue
+			}
+			// Any other statement that is not indented ends the class.
+			if trimmed := strings.TrimSpace(line); trimmed != "" && line[0] != ' ' && line[0] != '\t' && line[0] != '#' && line[0] != '@' && line[0] != ')' {
+				class = ""
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tests, nil
+}
+
+func (a *Pytest) Command(dir string, tests []Test, report string) []string {
+	command := []string{"pytest", "--junitxml=" + report, "-o", "junit_family=xunit1"}
+	for _, test := range tests {
+		command = append(command, test.String())
+	}
+	return command
+}
+
+func (a *Pytest) Results(dir, output, report string) []Result {
+	cases, err := junit.ParseFile(report)
+	if err != nil {
+		return failedResults(pytestFailures(output))
+	}
+
+	var results []Result
+	for _, c := range cases {
+		// The class name is the dotted module, followed by the test class
+		// for methods.
+		suite := c.ClassName
+		if c.File != "" {
+			suite = filepath.ToSlash(c.File)
+			module := strings.ReplaceAll(strings.TrimSuffix(suite, ".py"), "/", ".")
+			if class, ok := strings.CutPrefix(c.ClassName, module+"."); ok {
+				suite += "::" + class
+			}
+		}
+		// pytest counts lines from zero.
+		result := Result{Test: Test{Suite: suite, Name: c.Name, File: c.File, Line: c.Line + 1}}
+		switch {
+		case c.Failure != nil:
+			result.Status = Failed
+			result.Message = firstLine(c.Failure.Message, nil)
+			if result.Message == "" {
+				result.Message = firstLine(c.Failure.Text, nil)
+			}
+			result.locate(c.Failure.Text)
+		case c.Skipped:
+			result.Status = Skipped
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// pytestFailures returns the tests pytest lists as failed in the short test
+// summary of output.
+func pytestFailures(output string) []Test {
+	var failures []Test
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		match := pytestFailure.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		id := match[1]
+		// Parametrized tests are rerun with all their parameters.
+		if i := strings.Index(id, "["); i >= 0 {
+			id = id[:i]
+		}
+		suite, name, _ := cutLast(id, "::")
+		failure := Test{Suite: suite, Name: name}
+		if !containsTest(failures, failure) {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
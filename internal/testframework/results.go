@@ -0,0 +1,110 @@
+package testframework
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Status is the outcome of a test.
+type Status int
+
+const (
+	Passed Status = iota
+	Failed
+	Skipped
+)
+
+// Result is the outcome of a test in a run.
+type Result struct {
+	Test   Test
+	Status Status
+	// Message tells why the test failed, like the assertion that failed,
+	// and File and Line where it failed when the framework reports it.
+	Message string
+	File    string
+	Line    int
+}
+
+// Count returns how many of results have status.
+func Count(results []Result, status Status) int {
+	n := 0
+	for _, result := range results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// FailedTests returns the tests of results that failed, to rerun them.
+func FailedTests(results []Result) []Test {
+	var tests []Test
+	for _, result := range results {
+		if result.Status == Failed && !containsTest(tests, result.Test) {
+			tests = append(tests, result.Test)
+		}
+	}
+	return tests
+}
+
+// failedResults returns a failed result without a message for each of tests,
+// for when only the names of the failed tests are known.
+func failedResults(tests []Test) []Result {
+	var results []Result
+	for _, test := range tests {
+		results = append(results, Result{Test: test, Status: Failed})
+	}
+	return results
+}
+
+// location matches a file and line in a message or stack trace, like
+// /app/tests/UserTest.php:14 or tests/test_user.py:7: AssertionError.
+var location = regexp.MustCompile(`([\w./\\-]*\w\.\w+):(\d+)`)
+
+// findLocation returns the last location in text that is in file, where the
+// failed assertion usually is, or the last location at all when none is.
+func findLocation(text, file string) (string, int) {
+	matches := location.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		return "", 0
+	}
+	found := matches[len(matches)-1]
+	for i := len(matches) - 1; i >= 0 && file != ""; i-- {
+		if sameFile(matches[i][1], file) {
+			found = matches[i]
+			break
+		}
+	}
+	line, _ := strconv.Atoi(found[2])
+	return found[1], line
+}
+
+// locate sets where the test of r failed from a message or stack trace, or
+// where the test is declared when text has no location.
+func (r *Result) locate(text string) {
+	r.File, r.Line = r.Test.File, r.Test.Line
+	if file, line := findLocation(text, r.Test.File); file != "" {
+		r.File, r.Line = file, line
+	}
+}
+
+// sameFile reports whether a and b are the same file, when one of them may
+// be relative to the project and the other absolute.
+func sameFile(a, b string) bool {
+	a, b = filepath.ToSlash(a), filepath.ToSlash(b)
+	return a == b || strings.HasSuffix(a, "/"+b) || strings.HasSuffix(b, "/"+a)
+}
+
+// firstLine returns the first line of text that is not empty and not
+// skipped.
+func firstLine(text string, skip func(line string) bool) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && (skip == nil || !skip(line)) {
+			return line
+		}
+	}
+	return ""
+}
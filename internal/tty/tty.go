@@ -0,0 +1,30 @@
+// Package tty puts the terminal in the modes evo needs to react to single
+// key presses.
+package tty
+
+import (
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// Cbreak makes key presses on the terminal fd readable one at a time without
+// echoing them. Unlike raw mode, output is still translated and Ctrl+C still
+// sends SIGINT. The returned state restores the terminal with term.Restore.
+func Cbreak(fd int) (*term.State, error) {
+	state, err := term.GetState(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
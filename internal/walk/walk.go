@@ -0,0 +1,38 @@
+// Package walk lists the files of a project, skipping the directories that
+// hold no sources of its own.
+package walk
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Files calls fn for every regular file below dir. Hidden directories and
+// directories named like one of skip are not entered.
+func Files(dir string, skip []string, fn func(path string, entry fs.DirEntry) error) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && (strings.HasPrefix(entry.Name(), ".") || contains(skip, entry.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		return fn(path, entry)
+	})
+}
+
+func contains(slice []string, value string) bool {
+	for _, s := range slice {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/signal"
 	"syscall"
 
 	"evo-cli/cmd"
@@ -11,10 +10,12 @@ import (
 	_ "embed"
 
 	"evo-cli/internal"
+	"evo-cli/internal/ptyrun"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/fatih/color"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 )
 
 var bananaArt = `
@@ -57,14 +58,23 @@ func displayArt() string {
 var red = color.New(color.FgHiRed).SprintfFunc()
 
 func main() {
-	// Setup global signal handling
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		fmt.Println(red("\nReceived CTRL+C, shutting down..."))
-		os.Exit(0)
-	}()
+	// Setup global signal handling. While a command runs the signal is
+	// passed on to it instead, and evo exits once the command did.
+	var terminalState *term.State
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		terminalState, _ = term.GetState(int(os.Stdin.Fd()))
+	}
+	ptyrun.HandleSignals(func(sig syscall.Signal) {
+		if terminalState != nil {
+			_ = term.Restore(int(os.Stdin.Fd()), terminalState)
+		}
+		if sig == syscall.SIGINT {
+			fmt.Println(red("\nReceived CTRL+C, shutting down..."))
+		} else {
+			fmt.Println(red("\nReceived %s, shutting down...", sig))
+		}
+		os.Exit(128 + int(sig))
+	})
 	// Load configuration from evo-cli.yml
 	// The configuration file is expected to be located either in the $HOME/.config directory
 	// or in the current working directory. It contains various settings such as the path to the